@@ -1,5 +1,93 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/crud"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/server"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/Filipza/excel-mapping-tool/pkg/domain/dataimport"
+	log "github.com/sirupsen/logrus"
+)
+
 func main() {
+	conf := settings.GetSettings()
+
+	if level, err := log.ParseLevel(conf.GetDefaultString("log.level", "info")); err == nil {
+		log.SetLevel(level)
+	}
+
+	backendTimeout := conf.GetDefaultDuration("backend.timeout", 30*time.Second)
+	client := &http.Client{Timeout: backendTimeout}
+
+	tariffUrl := conf.GetString("backend.tariff.url")
+	hardwareUrl := conf.GetString("backend.hardware.url")
+	if tariffUrl == "" || hardwareUrl == "" {
+		log.Fatal("backend.tariff.url and backend.hardware.url must be configured")
+	}
+
+	// Backends understanding "__in" filters let imports list their identifiers in bulk
+	var restOpts []crud.RESTOption
+	if conf.GetDefaultBool("backend.inFilter", false) {
+		restOpts = append(restOpts, crud.WithInFilter())
+	}
+
+	svc := dataimport.NewMappingService(
+		crud.NewRESTService[tariff.TariffCRUD, tariff.TariffLookup](tariffUrl, client, restOpts...),
+		crud.NewRESTService[hardware.HardwareCRUD, hardware.HardwareLookup](hardwareUrl, client, restOpts...),
+		dataimport.WithTemplateStore(dataimport.NewJSONTemplateStore(conf.GetDefaultString("dataimport.templates.file", "templates.json"))),
+		dataimport.WithBackendTimeout(backendTimeout),
+		dataimport.WithWorkers(conf.GetDefaultInt("dataimport.workers", 8)),
+		dataimport.WithHistoryStore(dataimport.NewJSONHistoryStore(conf.GetDefaultString("dataimport.history.dir", "history"))),
+		dataimport.WithUploadStore(dataimport.NewLocalUploadStore(conf.GetDefaultString("dataimport.uploads.dir", os.TempDir()))),
+		dataimport.WithSessionTTL(conf.GetDefaultDuration("dataimport.sessions.ttl", 30*time.Minute)),
+		dataimport.WithUploadLimits(dataimport.UploadLimits{
+			MaxBytes:             conf.GetDefaultInt64("dataimport.limits.bytes", dataimport.DefaultUploadLimits.MaxBytes),
+			MaxUncompressedBytes: conf.GetDefaultInt64("dataimport.limits.uncompressedBytes", dataimport.DefaultUploadLimits.MaxUncompressedBytes),
+			MaxSheets:            conf.GetDefaultInt("dataimport.limits.sheets", dataimport.DefaultUploadLimits.MaxSheets),
+			MaxRows:              conf.GetDefaultInt("dataimport.limits.rows", dataimport.DefaultUploadLimits.MaxRows),
+			MaxColumns:           conf.GetDefaultInt("dataimport.limits.columns", dataimport.DefaultUploadLimits.MaxColumns),
+		}),
+	)
+
+	// Sweeps right away to remove the uploads of sessions expired while the service was down
+	sweeper := time.NewTicker(conf.GetDefaultDuration("dataimport.sessions.sweepInterval", time.Minute))
+	defer sweeper.Stop()
+	go func() {
+		for ; true; <-sweeper.C {
+			if removed, err := svc.SweepSessions(); err != nil {
+				log.Error(err)
+			} else if removed > 0 {
+				log.Infof("removed %d expired uploads", removed)
+			}
+		}
+	}()
+
+	srv := server.NewServer(svc, conf)
+
+	go func() {
+		log.Infof("listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.GetDefaultDuration("server.timeout.shutdown", 30*time.Second))
+	defer cancel()
 
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error(err)
+	}
 }
@@ -0,0 +1,163 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+)
+
+// Number of calls answered from a Cache and passed to the wrapped service
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// ContextCRUDService remembering the results of List and Read, meant to live as long as a single unit of work,
+// e.g. an import. Read returns copies, so callers may modify them. Update and Delete replace the remembered object,
+// remembered lists are kept as they are. Failed calls aren't remembered.
+type Cache[T, L any] struct {
+	svc ContextCRUDService[T, L]
+
+	mu    sync.Mutex
+	lists map[string][]*L
+	objs  map[string]*T
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewCache[T, L any](svc ContextCRUDService[T, L]) *Cache[T, L] {
+	return &Cache[T, L]{svc: svc, lists: make(map[string][]*L), objs: make(map[string]*T)}
+}
+
+func (c *Cache[T, L]) Stats() CacheStats {
+	return CacheStats{Hits: int(c.hits.Load()), Misses: int(c.misses.Load())}
+}
+
+// Remembers the result of List with the given options, e.g. resolved in bulk beforehand
+func (c *Cache[T, L]) StoreList(result []*L, opts ...settings.Option) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lists[listKey(opts)] = result
+}
+
+func (c *Cache[T, L]) ListContext(ctx context.Context, opts ...settings.Option) ([]*L, error) {
+	key := listKey(opts)
+
+	c.mu.Lock()
+	result, ok := c.lists[key]
+	c.mu.Unlock()
+	if ok {
+		c.hits.Add(1)
+		return result, nil
+	}
+
+	c.misses.Add(1)
+	result, err := c.svc.ListContext(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.lists[key] = result
+	c.mu.Unlock()
+	return result, nil
+}
+
+func (c *Cache[T, L]) CreateContext(ctx context.Context, t *T, opts ...settings.Option) (*T, error) {
+	return c.svc.CreateContext(ctx, t, opts...)
+}
+
+func (c *Cache[T, L]) ReadContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	// Reads with options may return other representations of the object
+	if len(opts) > 0 {
+		c.misses.Add(1)
+		return c.svc.ReadContext(ctx, id, opts...)
+	}
+
+	c.mu.Lock()
+	obj, ok := c.objs[id]
+	c.mu.Unlock()
+	if ok {
+		c.hits.Add(1)
+		return Clone(obj)
+	}
+
+	c.misses.Add(1)
+	obj, err := c.svc.ReadContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.store(id, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (c *Cache[T, L]) UpdateContext(ctx context.Context, id string, t *T, opts ...settings.Option) (*T, error) {
+	result, err := c.svc.UpdateContext(ctx, id, t, opts...)
+	if err != nil {
+		// The object may or may not be written, so it is read again next time
+		c.forget(id)
+		return nil, err
+	}
+
+	written := result
+	if written == nil {
+		written = t
+	}
+	if err := c.store(id, written); err != nil {
+		c.forget(id)
+	}
+	return result, nil
+}
+
+func (c *Cache[T, L]) DeleteContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	defer c.forget(id)
+	return c.svc.DeleteContext(ctx, id, opts...)
+}
+
+// Remembers a copy of obj, so changes of the caller don't reach the cache
+func (c *Cache[T, L]) store(id string, obj *T) error {
+	stored, err := Clone(obj)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objs[id] = stored
+	return nil
+}
+
+func (c *Cache[T, L]) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objs, id)
+}
+
+func listKey(opts []settings.Option) string {
+	parts := make([]string, len(opts))
+	for i, opt := range opts {
+		parts[i] = fmt.Sprintf("%s=%s", opt.Name, opt.StringValue())
+	}
+	return strings.Join(parts, "&")
+}
+
+// Returns a deep copy of obj via JSON, the way the objects are transferred anyway
+func Clone[T any](obj *T) (*T, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	copied := new(T)
+	if err := json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
@@ -0,0 +1,112 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheRead(t *testing.T) {
+	svc := newMockService(&testObj{Id: "1", Name: "stored", Labels: []string{"a"}})
+	cache := NewCache(WithContext[testObj, testLookup](svc))
+	ctx := context.Background()
+
+	// Results are copies, changes of the caller don't reach the cache
+	for i := 0; i < 3; i++ {
+		obj, err := cache.ReadContext(ctx, "1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, &testObj{Id: "1", Name: "stored", Labels: []string{"a"}}, obj)
+		obj.Name = "changed"
+		obj.Labels[0] = "changed"
+	}
+	assert.Equal(t, 1, svc.reads)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+
+	// Reads with options aren't cached
+	_, err := cache.ReadContext(ctx, "1", settings.Option{Name: "expand", Value: "variants"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, svc.reads)
+
+	// Failed reads aren't remembered
+	_, err = cache.ReadContext(ctx, "2")
+	assert.Error(t, err)
+	svc.objs["2"] = &testObj{Id: "2"}
+	_, err = cache.ReadContext(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, svc.reads)
+}
+
+func TestCacheList(t *testing.T) {
+	svc := newMockService(&testObj{Id: "1"})
+	cache := NewCache(WithContext[testObj, testLookup](svc))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := cache.ListContext(ctx, settings.Option{Name: "name", Value: "x"})
+		assert.NoError(t, err)
+		assert.Len(t, result, 1)
+	}
+	assert.Equal(t, 1, svc.lists)
+
+	// Lists stored beforehand are answered without the service
+	cache.StoreList([]*testLookup{{Id: "2"}, {Id: "3"}}, settings.Option{Name: "name", Value: "y"})
+	result, err := cache.ListContext(ctx, settings.Option{Name: "name", Value: "y"})
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, 1, svc.lists)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+}
+
+func TestCacheUpdate(t *testing.T) {
+	svc := newMockService(&testObj{Id: "1", Name: "stored"})
+	cache := NewCache(WithContext[testObj, testLookup](svc))
+	ctx := context.Background()
+
+	_, err := cache.ReadContext(ctx, "1")
+	assert.NoError(t, err)
+
+	// The written object replaces the remembered one, later changes of the caller don't reach the cache
+	written := &testObj{Id: "1", Name: "updated", Labels: []string{"a"}}
+	_, err = cache.UpdateContext(ctx, "1", written)
+	assert.NoError(t, err)
+	written.Name = "changed"
+	written.Labels[0] = "changed"
+
+	obj, err := cache.ReadContext(ctx, "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &testObj{Id: "1", Name: "updated", Labels: []string{"a"}}, obj)
+	}
+	assert.Equal(t, 1, svc.reads)
+
+	// Failed updates make the object be read again
+	svc.objs["1"] = &testObj{Id: "1", Name: "stored"}
+	svc.updateErr = errors.New("update failed")
+	_, err = cache.UpdateContext(ctx, "1", &testObj{Id: "1", Name: "lost"})
+	assert.Error(t, err)
+
+	obj, err = cache.ReadContext(ctx, "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "stored", obj.Name)
+	}
+	assert.Equal(t, 2, svc.reads)
+}
+
+func TestCacheDelete(t *testing.T) {
+	svc := newMockService(&testObj{Id: "1"})
+	cache := NewCache(WithContext[testObj, testLookup](svc))
+	ctx := context.Background()
+
+	_, err := cache.ReadContext(ctx, "1")
+	assert.NoError(t, err)
+	_, err = cache.DeleteContext(ctx, "1")
+	assert.NoError(t, err)
+
+	_, err = cache.ReadContext(ctx, "1")
+	assert.Error(t, err, "deleted objects are read again")
+	assert.Equal(t, 2, svc.reads)
+}
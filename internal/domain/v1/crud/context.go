@@ -0,0 +1,109 @@
+package crud
+
+import (
+	"context"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+)
+
+// CRUDService whose calls take a context, so they can be cancelled and bounded by a deadline
+type ContextCRUDService[T, L any] interface {
+	ListContext(context.Context, ...settings.Option) ([]*L, error)
+	CreateContext(context.Context, *T, ...settings.Option) (*T, error)
+	ReadContext(context.Context, string, ...settings.Option) (*T, error)
+	UpdateContext(context.Context, string, *T, ...settings.Option) (*T, error)
+	DeleteContext(context.Context, string, ...settings.Option) (*T, error)
+}
+
+// Returns the context-aware variant of svc. Services without one can't be interrupted,
+// calls made after the context is done fail with its error without reaching svc.
+func WithContext[T, L any](svc CRUDService[T, L]) ContextCRUDService[T, L] {
+	if ctxSvc, ok := svc.(ContextCRUDService[T, L]); ok {
+		return ctxSvc
+	}
+	return &contextAdapter[T, L]{svc}
+}
+
+type contextAdapter[T, L any] struct {
+	svc CRUDService[T, L]
+}
+
+func (a *contextAdapter[T, L]) ListContext(ctx context.Context, opts ...settings.Option) ([]*L, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.svc.List(opts...)
+}
+
+func (a *contextAdapter[T, L]) CreateContext(ctx context.Context, t *T, opts ...settings.Option) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.svc.Create(t, opts...)
+}
+
+func (a *contextAdapter[T, L]) ReadContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.svc.Read(id, opts...)
+}
+
+func (a *contextAdapter[T, L]) UpdateContext(ctx context.Context, id string, t *T, opts ...settings.Option) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.svc.Update(id, t, opts...)
+}
+
+func (a *contextAdapter[T, L]) DeleteContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.svc.Delete(id, opts...)
+}
+
+// Bounds every call of svc by the timeout, in addition to the deadline of the passed context.
+// Returns svc itself if timeout is 0.
+func WithTimeout[T, L any](svc ContextCRUDService[T, L], timeout time.Duration) ContextCRUDService[T, L] {
+	if timeout <= 0 {
+		return svc
+	}
+	return &timeoutService[T, L]{svc: svc, timeout: timeout}
+}
+
+type timeoutService[T, L any] struct {
+	svc     ContextCRUDService[T, L]
+	timeout time.Duration
+}
+
+func (s *timeoutService[T, L]) ListContext(ctx context.Context, opts ...settings.Option) ([]*L, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.svc.ListContext(ctx, opts...)
+}
+
+func (s *timeoutService[T, L]) CreateContext(ctx context.Context, t *T, opts ...settings.Option) (*T, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.svc.CreateContext(ctx, t, opts...)
+}
+
+func (s *timeoutService[T, L]) ReadContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.svc.ReadContext(ctx, id, opts...)
+}
+
+func (s *timeoutService[T, L]) UpdateContext(ctx context.Context, id string, t *T, opts ...settings.Option) (*T, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.svc.UpdateContext(ctx, id, t, opts...)
+}
+
+func (s *timeoutService[T, L]) DeleteContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.svc.DeleteContext(ctx, id, opts...)
+}
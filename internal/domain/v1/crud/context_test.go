@@ -0,0 +1,161 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type testObj struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+}
+
+type testLookup struct {
+	Id string `json:"id"`
+}
+
+// CRUDService without context support, counting its calls
+type mockService struct {
+	objs      map[string]*testObj
+	lists     int
+	reads     int
+	updateErr error // returned by Update instead of storing the object
+}
+
+func newMockService(objs ...*testObj) *mockService {
+	svc := &mockService{objs: make(map[string]*testObj)}
+	for _, obj := range objs {
+		svc.objs[obj.Id] = obj
+	}
+	return svc
+}
+
+func (svc *mockService) List(opts ...settings.Option) ([]*testLookup, error) {
+	svc.lists++
+	var result []*testLookup
+	for id := range svc.objs {
+		result = append(result, &testLookup{Id: id})
+	}
+	return result, nil
+}
+
+func (svc *mockService) Create(t *testObj, opts ...settings.Option) (*testObj, error) {
+	svc.objs[t.Id] = t
+	return t, nil
+}
+
+func (svc *mockService) Read(id string, opts ...settings.Option) (*testObj, error) {
+	svc.reads++
+	obj, ok := svc.objs[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return obj, nil
+}
+
+func (svc *mockService) Update(id string, t *testObj, opts ...settings.Option) (*testObj, error) {
+	if svc.updateErr != nil {
+		return nil, svc.updateErr
+	}
+	svc.objs[id] = t
+	return t, nil
+}
+
+func (svc *mockService) Delete(id string, opts ...settings.Option) (*testObj, error) {
+	obj := svc.objs[id]
+	delete(svc.objs, id)
+	return obj, nil
+}
+
+func TestWithContext(t *testing.T) {
+	svc := newMockService(&testObj{Id: "1"})
+	ctxSvc := WithContext[testObj, testLookup](svc)
+
+	obj, err := ctxSvc.ReadContext(context.Background(), "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", obj.Id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = ctxSvc.ListContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = ctxSvc.ReadContext(ctx, "1")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = ctxSvc.UpdateContext(ctx, "1", &testObj{Id: "1", Name: "changed"})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = ctxSvc.DeleteContext(ctx, "1")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Zero(t, svc.lists, "calls after the cancellation don't reach the service")
+	assert.Equal(t, 1, svc.reads)
+	assert.Equal(t, "", svc.objs["1"].Name)
+
+	// Services supporting contexts themselves are used as they are
+	rest := NewRESTService[testObj, testLookup]("http://localhost", nil)
+	assert.Same(t, rest, WithContext(rest))
+}
+
+// Backend answering once the request is cancelled by the client
+func newHangingBackend(t *testing.T) *httptest.Server {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestWithTimeout(t *testing.T) {
+	backend := newHangingBackend(t)
+	svc := WithContext(NewRESTService[testObj, testLookup](backend.URL, nil))
+
+	assert.Same(t, svc, WithTimeout(svc, 0), "no timeout leaves the service as it is")
+
+	bounded := WithTimeout(svc, 20*time.Millisecond)
+
+	start := time.Now()
+	_, err := bounded.ReadContext(context.Background(), "1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "the call is interrupted by the timeout")
+
+	// The passed context still stops calls before the timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = WithTimeout(svc, time.Minute).ListContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWithTimeoutNoLeak(t *testing.T) {
+	backend := newHangingBackend(t)
+	bounded := WithTimeout(WithContext(NewRESTService[testObj, testLookup](backend.URL, nil)), 5*time.Millisecond)
+
+	// Warms up the connections of the client
+	_, _ = bounded.ReadContext(context.Background(), "1")
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		_, err := bounded.ReadContext(context.Background(), "1")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	// Goroutines of interrupted calls end once their requests are torn down
+	assert.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= before+2
+	}, 2*time.Second, 10*time.Millisecond, "timed out calls leave goroutines behind")
+}
@@ -0,0 +1,24 @@
+package crud
+
+import (
+	"strings"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+)
+
+// Implemented by services whose List may match several values of a filter at once, see In
+type InFilterService interface {
+	SupportsInFilter() bool
+}
+
+// Reports whether List of svc understands In filters
+func SupportsInFilter(svc any) bool {
+	inSvc, ok := svc.(InFilterService)
+	return ok && inSvc.SupportsInFilter()
+}
+
+// Filter matching every object whose field matches any of the values, e.g. "ebootis_id__in=T-1,T-2".
+// Values must not contain commas.
+func In(name string, values ...string) settings.Option {
+	return settings.Option{Name: name + "__in", Value: strings.Join(values, ",")}
+}
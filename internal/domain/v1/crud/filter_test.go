@@ -0,0 +1,28 @@
+package crud
+
+import (
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+// Service reporting whether it supports In filters
+type inFilterFlag bool
+
+func (f inFilterFlag) SupportsInFilter() bool {
+	return bool(f)
+}
+
+func TestSupportsInFilter(t *testing.T) {
+	assert.False(t, SupportsInFilter(newMockService()), "services not implementing InFilterService don't support it")
+	assert.False(t, SupportsInFilter(inFilterFlag(false)))
+	assert.True(t, SupportsInFilter(inFilterFlag(true)))
+
+	assert.False(t, SupportsInFilter(NewRESTService[testObj, testLookup]("http://localhost", nil)))
+	assert.True(t, SupportsInFilter(NewRESTService[testObj, testLookup]("http://localhost", nil, WithInFilter())))
+}
+
+func TestIn(t *testing.T) {
+	assert.Equal(t, settings.Option{Name: "ebootis_id__in", Value: "T-1,T-2"}, In("ebootis_id", "T-1", "T-2"))
+}
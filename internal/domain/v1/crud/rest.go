@@ -0,0 +1,162 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+)
+
+// restService implements CRUDService and ContextCRUDService against a JSON REST resource of the backend.
+// Options passed to any method are sent as query parameters.
+type restService[T, L any] struct {
+	baseUrl  string
+	client   *http.Client
+	inFilter bool
+}
+
+// Configures optional capabilities of the backend behind a restService
+type RESTOption func(*restOptions)
+
+type restOptions struct {
+	inFilter bool
+}
+
+// Declares that the backend understands In filters
+func WithInFilter() RESTOption {
+	return func(opts *restOptions) {
+		opts.inFilter = true
+	}
+}
+
+func NewRESTService[T, L any](baseUrl string, client *http.Client, opts ...RESTOption) CRUDService[T, L] {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	options := restOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &restService[T, L]{baseUrl: strings.TrimRight(baseUrl, "/"), client: client, inFilter: options.inFilter}
+}
+
+func (svc *restService[T, L]) SupportsInFilter() bool {
+	return svc.inFilter
+}
+
+func (svc *restService[T, L]) List(opts ...settings.Option) ([]*L, error) {
+	return svc.ListContext(context.Background(), opts...)
+}
+
+func (svc *restService[T, L]) Create(t *T, opts ...settings.Option) (*T, error) {
+	return svc.CreateContext(context.Background(), t, opts...)
+}
+
+func (svc *restService[T, L]) Read(id string, opts ...settings.Option) (*T, error) {
+	return svc.ReadContext(context.Background(), id, opts...)
+}
+
+func (svc *restService[T, L]) Update(id string, t *T, opts ...settings.Option) (*T, error) {
+	return svc.UpdateContext(context.Background(), id, t, opts...)
+}
+
+func (svc *restService[T, L]) Delete(id string, opts ...settings.Option) (*T, error) {
+	return svc.DeleteContext(context.Background(), id, opts...)
+}
+
+func (svc *restService[T, L]) ListContext(ctx context.Context, opts ...settings.Option) ([]*L, error) {
+	result := make([]*L, 0)
+	if err := svc.do(ctx, http.MethodGet, "", nil, &result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *restService[T, L]) CreateContext(ctx context.Context, t *T, opts ...settings.Option) (*T, error) {
+	result := new(T)
+	if err := svc.do(ctx, http.MethodPost, "", t, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *restService[T, L]) ReadContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	result := new(T)
+	if err := svc.do(ctx, http.MethodGet, id, nil, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *restService[T, L]) UpdateContext(ctx context.Context, id string, t *T, opts ...settings.Option) (*T, error) {
+	result := new(T)
+	if err := svc.do(ctx, http.MethodPut, id, t, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *restService[T, L]) DeleteContext(ctx context.Context, id string, opts ...settings.Option) (*T, error) {
+	result := new(T)
+	if err := svc.do(ctx, http.MethodDelete, id, nil, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (svc *restService[T, L]) do(ctx context.Context, method string, id string, body any, target any, opts ...settings.Option) error {
+	reqUrl := svc.baseUrl
+	if id != "" {
+		reqUrl += "/" + url.PathEscape(id)
+	}
+
+	if len(opts) > 0 {
+		query := url.Values{}
+		for _, opt := range opts {
+			query.Add(opt.Name, opt.StringValue())
+		}
+		reqUrl += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := svc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: unexpected status %d: %s", method, reqUrl, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
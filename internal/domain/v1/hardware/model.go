@@ -322,6 +322,8 @@ type VariantCRUD struct {
 	PublicationDate       string  `json:"publicationDate"` // as YYYY-MM-DD
 	PkCouponName          string  `json:"pkCouponName"`
 	PkCouponValue         float64 `json:"pkCouponValue"`
+	Stock                 *int    `json:"stock,omitempty"`         // nil unless the backend sent it or it was imported
+	OriginalStock         *int    `json:"originalStock,omitempty"` // nil unless the backend sent it or it was imported
 }
 
 func (va *VariantCRUD) AsLookup(hardwareLabel string) *VariantLookup {
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Filipza/excel-mapping-tool/pkg/domain/dataimport"
+	log "github.com/sirupsen/logrus"
+)
+
+func (srv *server) handleReadFile(w http.ResponseWriter, r *http.Request) {
+	// Parts not kept in memory are spooled to disk, so the size of uploads is bounded before they are parsed
+	if srv.maxUploadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, srv.maxUploadBytes+multipartOverhead)
+	}
+	if err := r.ParseMultipartForm(srv.maxMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, requestLocale(r, ""), dataimport.ErrUploadTooLarge(srv.maxUploadBytes))
+			return
+		}
+		writeBadRequest(w, requestLocale(r, ""), dataimport.ReasonNotMultipart)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	locale := requestLocale(r, r.FormValue("locale"))
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeBadRequest(w, locale, dataimport.ReasonFileMissing)
+		return
+	}
+	defer file.Close()
+
+	headerRow := 0
+	if val := r.FormValue("headerRow"); val != "" {
+		if headerRow, err = strconv.Atoi(val); err != nil {
+			writeBadRequest(w, locale, dataimport.ReasonHeaderRowInvalid)
+			return
+		}
+	}
+
+	options, err := srv.svc.ReadFileContext(r.Context(), &dataimport.UploadData{
+		UploadedFile: file,
+		UploadType:   r.FormValue("uploadType"),
+		Uuid:         r.FormValue("uuid"),
+		User:         r.FormValue("user"),
+		Sheet:        r.FormValue("sheet"),
+		HeaderRow:    headerRow,
+		Locale:       locale,
+	})
+	if err != nil {
+		writeError(w, locale, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+func (srv *server) handleWriteMapping(w http.ResponseWriter, r *http.Request) {
+	mi := &dataimport.MappingInstruction{}
+	if !srv.readJSON(w, r, mi, dataimport.ReasonMappingUnreadable) {
+		return
+	}
+	mi.Uuid = r.PathValue("uuid")
+	mi.Locale = requestLocale(r, mi.Locale)
+
+	// Synchronous imports are stopped if the client disconnects, the partial result is of no use then.
+	// Background imports keep running and are answered with their initial status.
+	result, err := srv.svc.WriteMappingContext(r.Context(), mi)
+	if err != nil {
+		writeError(w, mi.Locale, err)
+		return
+	}
+
+	if result.Job != nil {
+		writeJSON(w, http.StatusAccepted, result)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (srv *server) handleErrorReport(w http.ResponseWriter, r *http.Request) {
+	uploadUuid := r.PathValue("uuid")
+
+	report, err := srv.svc.ErrorReport(uploadUuid)
+	if err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+	defer report.Close()
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="fehler-%s.xlsx"`, uploadUuid))
+	if _, err := io.Copy(w, report); err != nil {
+		log.Error(err)
+	}
+}
+
+func (srv *server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := srv.svc.JobStatus(r.PathValue("uuid"))
+	if err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleJobEvents streams the progress of a background import as server-sent events. Every change is sent as
+// "progress" event, the final status as "done" or "failed" event.
+func (srv *server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, requestLocale(r, ""), errors.New("streaming unsupported"))
+		return
+	}
+
+	updates, err := srv.svc.WatchJob(r.Context(), r.PathValue("uuid"))
+	if err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for status := range updates {
+		data, err := json.Marshal(status)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		event := "progress"
+		if status.State != dataimport.JobRunning {
+			event = string(status.State)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (srv *server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := srv.svc.CancelJob(r.PathValue("uuid")); err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (srv *server) handleRevertImport(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(r, "")
+
+	result, err := srv.svc.RevertImport(r.PathValue("uuid"))
+	if err != nil {
+		writeError(w, locale, err)
+		return
+	}
+
+	for i := range result.Conflicts {
+		result.Conflicts[i].Localize(locale)
+	}
+	for i := range result.Failures {
+		result.Failures[i].Localize(locale)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (srv *server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := srv.svc.ListTemplates(r.URL.Query().Get("uploadType"))
+	if err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, templates)
+}
+
+func (srv *server) handleSaveTemplate(w http.ResponseWriter, r *http.Request) {
+	template := &dataimport.MappingTemplate{}
+	if !srv.readJSON(w, r, template, dataimport.ReasonTemplateUnreadable) {
+		return
+	}
+
+	if err := srv.svc.SaveTemplate(template); err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, template)
+}
+
+func (srv *server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := srv.svc.DeleteTemplate(r.PathValue("uploadType"), r.PathValue("name")); err != nil {
+		writeError(w, requestLocale(r, ""), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readJSON decodes the request body into body, cut off after maxBodyBytes. Failures are answered,
+// reason tells the client what could not be read.
+func (srv *server) readJSON(w http.ResponseWriter, r *http.Request, body any, reason dataimport.BadRequestReason) bool {
+	if srv.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, srv.maxBodyBytes)
+	}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, requestLocale(r, ""), dataimport.ErrRequestTooLarge(srv.maxBodyBytes))
+			return false
+		}
+		writeBadRequest(w, requestLocale(r, ""), reason)
+		return false
+	}
+	return true
+}
+
+// writeBadRequest answers requests that are malformed rather than carrying faulty data
+func writeBadRequest(w http.ResponseWriter, locale string, reason dataimport.BadRequestReason) {
+	writeError(w, locale, dataimport.ErrBadRequest(reason))
+}
+
+// writeError answers with the error rendered in the language of the locale
+func writeError(w http.ResponseWriter, locale string, err error) {
+	var importErr *dataimport.Error
+	if errors.As(err, &importErr) {
+		writeJSON(w, errorStatus(importErr.Code), importErr.Localize(locale))
+		return
+	}
+
+	log.Error(err)
+	writeJSON(w, http.StatusInternalServerError, (&dataimport.Error{Code: dataimport.ErrCodeInternal}).Localize(locale))
+}
+
+// requestLocale returns the explicitly requested locale, else the preferred language of the Accept-Language header
+func requestLocale(r *http.Request, explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	lang, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	return strings.TrimSpace(lang)
+}
+
+// Errors about faulty uploads or mappings are answered with 422, missing resources and server-side failures
+// with their own status
+func errorStatus(code dataimport.ErrorCode) int {
+	switch code {
+	case dataimport.ErrCodeBadRequest, dataimport.ErrCodeUuidInvalid:
+		return http.StatusBadRequest
+	case dataimport.ErrCodeUploadNotFound, dataimport.ErrCodeReportNotFound, dataimport.ErrCodeImportNotFound, dataimport.ErrCodeJobNotFound:
+		return http.StatusNotFound
+	case dataimport.ErrCodeJobRunning, dataimport.ErrCodeUploadImported, dataimport.ErrCodeUploadExists:
+		return http.StatusConflict
+	case dataimport.ErrCodeSessionExpired:
+		return http.StatusGone
+	case dataimport.ErrCodeUploadTooLarge, dataimport.ErrCodeRequestTooLarge, dataimport.ErrCodeUncompressedTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case dataimport.ErrCodeCancelled:
+		return http.StatusRequestTimeout
+	case dataimport.ErrCodeTemplatesDisabled, dataimport.ErrCodeHistoryDisabled:
+		return http.StatusNotImplemented
+	case dataimport.ErrCodeInternal, dataimport.ErrCodeStorageFailed, dataimport.ErrCodeTemplateStoreFailed, dataimport.ErrCodeHistoryStoreFailed:
+		return http.StatusInternalServerError
+	}
+	return http.StatusUnprocessableEntity
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/crud"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/pkg/domain/dataimport"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tariff backend storing the tariffs written to it. onUpdate is called before a tariff is stored with the
+// context of the request.
+type tariffBackend struct {
+	mu       sync.Mutex
+	updated  []string
+	onUpdate func(ctx context.Context, id string)
+}
+
+func (b *tariffBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		json.NewEncoder(w).Encode([]*tariff.TariffLookup{{Id: r.URL.Query().Get("ebootis_id")}})
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(&tariff.TariffCRUD{Id: id, EbootisId: id})
+	case r.Method == http.MethodPut:
+		// Disconnects are only noticed once the body is read
+		tc := &tariff.TariffCRUD{}
+		json.NewDecoder(r.Body).Decode(tc)
+		io.Copy(io.Discard, r.Body)
+
+		if b.onUpdate != nil {
+			b.onUpdate(r.Context(), id)
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		b.mu.Lock()
+		b.updated = append(b.updated, id)
+		b.mu.Unlock()
+		json.NewEncoder(w).Encode(tc)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Service of the handlers, importing tariffs into the given backend
+func newTestServer(t *testing.T, backend http.Handler) (*server, dataimport.MappingService) {
+	t.Helper()
+
+	backendSrv := httptest.NewServer(backend)
+	t.Cleanup(backendSrv.Close)
+
+	svc := dataimport.NewMappingService(
+		crud.NewRESTService[tariff.TariffCRUD, tariff.TariffLookup](backendSrv.URL, nil),
+		crud.NewRESTService[hardware.HardwareCRUD, hardware.HardwareLookup](backendSrv.URL, nil),
+		dataimport.WithUploadStore(dataimport.NewMemoryUploadStore()),
+	)
+	return &server{svc: svc, maxMemory: 32 << 20, maxBodyBytes: 1 << 20}, svc
+}
+
+func TestHandleWriteMappingCancelled(t *testing.T) {
+	clientCtx, cancelClient := context.WithCancel(context.Background())
+	defer cancelClient()
+
+	// The client disconnects while T-2 is written. The backend call only ends once the disconnect stopped the import.
+	backend := &tariffBackend{}
+	backend.onUpdate = func(ctx context.Context, id string) {
+		if id != "T-2" {
+			return
+		}
+		cancelClient()
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+	srv, svc := newTestServer(t, backend)
+
+	options, err := svc.ReadFile(&dataimport.UploadData{
+		UploadedFile: strings.NewReader("EbootisId;Grundgebühr\nT-1;29,99\nT-2;39,99\nT-3;49,99\n"),
+		UploadType:   "tariff",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	handled := make(chan struct{})
+	routes := srv.routes()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handled)
+		routes.ServeHTTP(w, r)
+	}))
+	defer api.Close()
+
+	body, _ := json.Marshal(&dataimport.MappingInstruction{
+		Mapping: []dataimport.MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+		},
+		UploadType: "tariff",
+	})
+	req, _ := http.NewRequestWithContext(clientCtx, http.MethodPost, api.URL+"/imports/"+options.Uuid+"/mapping", bytes.NewReader(body))
+	_, err = http.DefaultClient.Do(req)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("import wasn't stopped by the disconnect")
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	assert.Equal(t, []string{"T-1"}, backend.updated, "rows after the disconnect are not imported")
+}
+
+// Multipart upload of a csv file with the given number of data rows
+func newUploadRequest(t *testing.T, rows int) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("uploadType", "tariff")
+	file, err := form.CreateFormFile("file", "tarife.csv")
+	if err != nil {
+		t.Fatalf("Creating upload failed: %v", err)
+	}
+	io.WriteString(file, "EbootisId;Grundgebühr\n"+strings.Repeat("T-1;29,99\n", rows))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/imports", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestHandleReadFileTooLarge(t *testing.T) {
+	srv, _ := newTestServer(t, &tariffBackend{})
+	srv.maxUploadBytes = 1 << 10
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, newUploadRequest(t, 10))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Cut off after the limit plus room for the form, instead of being spooled to disk completely
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, newUploadRequest(t, 200000))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	importErr := &dataimport.Error{}
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(importErr)) {
+		assert.Equal(t, dataimport.ErrCodeUploadTooLarge, importErr.Code)
+		assert.Contains(t, importErr.ErrMsg, "1 KB")
+	}
+}
+
+func TestHandleBadRequestLocalized(t *testing.T) {
+	srv, _ := newTestServer(t, &tariffBackend{})
+
+	req := httptest.NewRequest(http.MethodPost, "/imports", strings.NewReader("{}"))
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	importErr := &dataimport.Error{}
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(importErr)) {
+		assert.Equal(t, dataimport.ErrCodeBadRequest, importErr.Code)
+		assert.Equal(t, "Invalid request", importErr.ErrTitle)
+		assert.Equal(t, "The request must be sent as multipart/form-data.", importErr.ErrMsg)
+	}
+}
+
+func TestHandleJSONTooLarge(t *testing.T) {
+	srv, _ := newTestServer(t, &tariffBackend{})
+	srv.maxBodyBytes = 1 << 10
+
+	padding := strings.Repeat(" ", 2<<10)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/imports/0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60/mapping", strings.NewReader(padding+"{}")),
+		httptest.NewRequest(http.MethodPost, "/templates", strings.NewReader(padding+"{}")),
+	} {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, req.URL.Path)
+
+		importErr := &dataimport.Error{}
+		if assert.NoError(t, json.NewDecoder(rec.Body).Decode(importErr)) {
+			assert.Equal(t, dataimport.ErrCodeRequestTooLarge, importErr.Code)
+			assert.Contains(t, importErr.ErrMsg, "1 KB")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/Filipza/excel-mapping-tool/pkg/domain/dataimport"
+)
+
+// Room for the form fields and boundaries of multipart uploads besides the file
+const multipartOverhead = 1 << 20
+
+type server struct {
+	svc dataimport.MappingService
+	// Bytes of multipart uploads kept in memory, the rest is spooled to disk
+	maxMemory int64
+	// Size of uploaded files, requests exceeding it are cut off while they are received. Unlimited if not positive.
+	maxUploadBytes int64
+	// Size of JSON request bodies, cut off the same way. Unlimited if not positive.
+	maxBodyBytes int64
+}
+
+// NewServer exposes the given MappingService as REST API.
+// Port and limits are read from the settings ("server.*").
+func NewServer(svc dataimport.MappingService, conf settings.Settings) *http.Server {
+	srv := &server{
+		svc:       svc,
+		maxMemory: conf.GetDefaultInt64("server.upload.maxmemory", 32<<20),
+		// Same limit as ReadFile applies, see dataimport.UploadLimits
+		maxUploadBytes: conf.GetDefaultInt64("dataimport.limits.bytes", dataimport.DefaultUploadLimits.MaxBytes),
+		maxBodyBytes:   conf.GetDefaultInt64("server.limits.body", 1<<20),
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", conf.GetDefaultInt("server.port", 8080)),
+		Handler:           srv.routes(),
+		ReadHeaderTimeout: conf.GetDefaultDuration("server.timeout.readheader", 10*time.Second),
+	}
+}
+
+func (srv *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /imports", srv.handleReadFile)
+	mux.HandleFunc("POST /imports/{uuid}/mapping", srv.handleWriteMapping)
+	mux.HandleFunc("GET /imports/{uuid}/report", srv.handleErrorReport)
+	mux.HandleFunc("POST /imports/{uuid}/revert", srv.handleRevertImport)
+	mux.HandleFunc("GET /imports/{uuid}/job", srv.handleJobStatus)
+	mux.HandleFunc("GET /imports/{uuid}/job/events", srv.handleJobEvents)
+	mux.HandleFunc("DELETE /imports/{uuid}/job", srv.handleCancelJob)
+	mux.HandleFunc("GET /templates", srv.handleListTemplates)
+	mux.HandleFunc("POST /templates", srv.handleSaveTemplate)
+	mux.HandleFunc("DELETE /templates/{uploadType}/{name}", srv.handleDeleteTemplate)
+	return mux
+}
@@ -0,0 +1,144 @@
+package dataimport
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMappingCancelled(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr"},
+		{"T-1", "29,99"},
+		{"T-2", "39,99"},
+		{"T-3", "49,99"},
+	})
+
+	for _, transactional := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		stored := map[string]float64{"T-1": 9.99, "T-2": 9.99, "T-3": 9.99}
+		svc := &mappingService{
+			tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+				list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+					return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+				},
+				read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					return &tariff.TariffCRUD{Id: s, BasicCharge: stored[s]}, nil
+				},
+				update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					stored[s] = tc.BasicCharge
+					if s == "T-2" {
+						cancel() // e.g. the client disconnects
+					}
+					return tc, nil
+				},
+			},
+		}
+
+		options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		result, err := svc.WriteMappingContext(ctx, &MappingInstruction{
+			Uuid: options.Uuid,
+			Mapping: []MappingObject{
+				{ColIndex: 1, MappingValue: "ebootisId"},
+				{ColIndex: 2, MappingValue: "basicCharge"},
+			},
+			UploadType:    "tariff",
+			Transactional: transactional,
+		})
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.True(t, result.Cancelled)
+		assert.Equal(t, 2, result.SuccessfulRows)
+		assert.Empty(t, result.FailedRows, "rows after the cancellation are not reported as failed")
+		assert.Equal(t, 9.99, stored["T-3"], "rows after the cancellation are not imported")
+
+		if transactional {
+			assert.True(t, result.RolledBack)
+			assert.Equal(t, 9.99, stored["T-1"], "rollback is not stopped by the cancellation")
+			assert.Equal(t, 9.99, stored["T-2"])
+		} else {
+			assert.False(t, result.RolledBack)
+			assert.Equal(t, 39.99, stored["T-2"])
+		}
+	}
+}
+
+func TestReadFileCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	svc := &mappingService{}
+	_, err := svc.ReadFileContext(ctx, &UploadData{
+		UploadedFile: bytes.NewReader(newTestWorkbook(t, [][]string{{"EbootisId"}, {"T-1"}})),
+		UploadType:   "tariff",
+	})
+
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeCancelled, importErr.Code)
+	}
+}
+
+// Tariff backend honouring deadlines, whose List blocks until the deadline is exceeded
+type blockingTariffs struct {
+	*crudMock[tariff.TariffCRUD, tariff.TariffLookup]
+}
+
+func (m blockingTariffs) ListContext(ctx context.Context, opts ...settings.Option) ([]*tariff.TariffLookup, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m blockingTariffs) CreateContext(ctx context.Context, t *tariff.TariffCRUD, opts ...settings.Option) (*tariff.TariffCRUD, error) {
+	return m.Create(t, opts...)
+}
+
+func (m blockingTariffs) ReadContext(ctx context.Context, id string, opts ...settings.Option) (*tariff.TariffCRUD, error) {
+	return m.Read(id, opts...)
+}
+
+func (m blockingTariffs) UpdateContext(ctx context.Context, id string, t *tariff.TariffCRUD, opts ...settings.Option) (*tariff.TariffCRUD, error) {
+	return m.Update(id, t, opts...)
+}
+
+func (m blockingTariffs) DeleteContext(ctx context.Context, id string, opts ...settings.Option) (*tariff.TariffCRUD, error) {
+	return m.Delete(id, opts...)
+}
+
+func TestWriteMappingBackendTimeout(t *testing.T) {
+	svc := &mappingService{
+		tariffAdapter:  blockingTariffs{&crudMock[tariff.TariffCRUD, tariff.TariffLookup]{}},
+		backendTimeout: 20 * time.Millisecond,
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(newTestWorkbook(t, [][]string{{"EbootisId"}, {"T-1"}})),
+		UploadType:   "tariff",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid:       options.Uuid,
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}},
+		UploadType: "tariff",
+	})
+	if assert.NoError(t, err) {
+		assert.False(t, result.Cancelled, "exceeded backend deadlines fail the row only")
+		if assert.Len(t, result.FailedRows, 1) {
+			assert.Equal(t, ErrCodeLookupFailed, result.FailedRows[0].Code)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dataimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Flattens the JSON representation of obj into a map of field paths (e.g. "variants[0].price") to leaf values
+func flatten(obj any) (map[string]any, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]any)
+	flattenInto(result, "", tree)
+	return result, nil
+}
+
+func flattenInto(result map[string]any, path string, node any) {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			flattenInto(result, childPath, child)
+		}
+	case []any:
+		for i, child := range v {
+			flattenInto(result, fmt.Sprintf("%s[%d]", path, i), child)
+		}
+	default:
+		result[path] = v
+	}
+}
+
+// Returns all fields whose values differ between the flattened before and after states, sorted by field path
+func diffFields(before, after map[string]any) []FieldChange {
+	changes := make([]FieldChange, 0)
+
+	for path, oldVal := range before {
+		newVal, ok := after[path]
+		if !ok || !reflect.DeepEqual(oldVal, newVal) {
+			changes = append(changes, FieldChange{Field: path, OldValue: oldVal, NewValue: newVal})
+		}
+	}
+
+	for path, newVal := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, FieldChange{Field: path, NewValue: newVal})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// Builds the change of an entity compared to its flattened state before the mapping was applied.
+// Returns false if nothing changed.
+func entityChange(entityType string, id string, before map[string]any, obj any) (EntityChange, bool, error) {
+	after, err := flatten(obj)
+	if err != nil {
+		return EntityChange{}, false, err
+	}
+
+	fields := diffFields(before, after)
+	if len(fields) == 0 {
+		return EntityChange{}, false, nil
+	}
+
+	return EntityChange{EntityType: entityType, EntityId: id, Fields: fields}, true, nil
+}
+
+// Merges the field changes of a later row into the change of the same entity. Old values are kept from the first
+// row, new values are taken from the later row. Fields ending up at their old value are dropped.
+func mergeChange(into *EntityChange, later EntityChange) {
+	byField := make(map[string]int, len(into.Fields))
+	for i, field := range into.Fields {
+		byField[field.Field] = i
+	}
+	for _, field := range later.Fields {
+		if i, ok := byField[field.Field]; ok {
+			into.Fields[i].NewValue = field.NewValue
+			continue
+		}
+		into.Fields = append(into.Fields, field)
+	}
+
+	fields := into.Fields[:0]
+	for _, field := range into.Fields {
+		if !reflect.DeepEqual(field.OldValue, field.NewValue) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Field < fields[j].Field
+	})
+	into.Fields = fields
+}
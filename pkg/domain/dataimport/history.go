@@ -0,0 +1,275 @@
+package dataimport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage of the records of completed imports
+type HistoryStore interface {
+	// Creates the record or replaces the one with the same uuid
+	Save(*ImportRecord) error
+	// Returns the record of the import, os.ErrNotExist if there is none
+	Get(uuid string) (*ImportRecord, error)
+}
+
+// HistoryStore keeping every record in its own JSON file named after the uuid of the import
+type jsonHistoryStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewJSONHistoryStore(dir string) HistoryStore {
+	return &jsonHistoryStore{dir: dir}
+}
+
+func (store *jsonHistoryStore) Save(record *ImportRecord) error {
+	if _, err := uuid.Parse(record.Uuid); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := os.MkdirAll(store.dir, 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path(record.Uuid), data)
+}
+
+func (store *jsonHistoryStore) Get(importUuid string) (*ImportRecord, error) {
+	if _, err := uuid.Parse(importUuid); err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	data, err := os.ReadFile(store.path(importUuid))
+	if err != nil {
+		return nil, err
+	}
+
+	record := &ImportRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (store *jsonHistoryStore) path(importUuid string) string {
+	return filepath.Join(store.dir, importUuid+".json")
+}
+
+// Builds the record of an import from the entities it wrote
+func newImportRecord(mi *MappingInstruction, journal *importJournal, rolledBack bool) (*ImportRecord, error) {
+	record := &ImportRecord{
+		Uuid:       mi.Uuid,
+		User:       mi.User,
+		UploadType: mi.UploadType,
+		Mapping:    mi.Mapping,
+		Timestamp:  time.Now(),
+		RolledBack: rolledBack,
+		Entities:   make([]EntityRecord, 0, len(journal.entries)),
+	}
+
+	for _, entry := range journal.entries {
+		before, err := json.Marshal(entry.before)
+		if err != nil {
+			return nil, err
+		}
+		after, err := json.Marshal(entry.after)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Entities = append(record.Entities, EntityRecord{
+			EntityType: entry.entityType,
+			EntityId:   entry.entityId,
+			Before:     before,
+			After:      after,
+		})
+	}
+	return record, nil
+}
+
+// Persists the record of the import. The import itself is complete at this point, so failures are only logged.
+func (svc *mappingService) recordImport(mi *MappingInstruction, journal *importJournal, rolledBack bool) {
+	if svc.historyStore == nil {
+		return
+	}
+
+	record, err := newImportRecord(mi, journal, rolledBack)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := svc.historyStore.Save(record); err != nil {
+		log.Error(err)
+	}
+}
+
+// Fields the backends set on every write, whoever made it. They aren't changes made after an import.
+var serverManagedFields = map[string]bool{"createdAt": true, "updatedAt": true}
+
+// Returns the changed fields between two flattened states of an entity, leaving out serverManagedFields
+func userChanges(before, after map[string]any) []FieldChange {
+	changes := diffFields(before, after)
+	result := changes[:0]
+	for _, change := range changes {
+		name := change.Field[strings.LastIndex(change.Field, ".")+1:]
+		if !serverManagedFields[name] {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// Restores all entities written by the import to their state before it, in reverse order of writing.
+// Entities written more than once are compared with their last written state and restored to the state
+// before their first write. Entities changed after the import are left untouched and reported as conflicts,
+// entities already in their state before the import are skipped. So a revert can be repeated once conflicts
+// are resolved.
+func (svc *mappingService) RevertImport(importUuid string) (*RevertResult, error) {
+	if svc.historyStore == nil {
+		return nil, newError(Error{Code: ErrCodeHistoryDisabled})
+	}
+
+	record, err := svc.historyStore.Get(importUuid)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, newError(Error{Code: ErrCodeImportNotFound, args: map[string]any{"uuid": importUuid}})
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{Code: ErrCodeHistoryStoreFailed})
+	}
+
+	result := &RevertResult{}
+
+	// State before the first write per entity
+	firstBefore := make(map[string]json.RawMessage)
+	for _, entity := range record.Entities {
+		key := entity.EntityType + "/" + entity.EntityId
+		if _, ok := firstBefore[key]; !ok {
+			firstBefore[key] = entity.Before
+		}
+	}
+
+	for i := len(record.Entities) - 1; i >= 0; i-- {
+		entity := record.Entities[i]
+		key := entity.EntityType + "/" + entity.EntityId
+		if _, ok := firstBefore[key]; !ok {
+			continue // reverted along with its last write
+		}
+		entity.Before = firstBefore[key]
+		delete(firstBefore, key)
+
+		revertErr := Error{EntityId: entity.EntityId}
+
+		current, err := svc.readEntity(context.Background(), entity.EntityType, entity.EntityId)
+		if err != nil {
+			log.Error(err)
+			revertErr.Code = ErrCodeRevertFailed
+			result.Failures = append(result.Failures, *newError(revertErr))
+			continue
+		}
+
+		currentFields, err := flatten(current)
+		if err != nil {
+			log.Error(err)
+			revertErr.Code = ErrCodeRevertFailed
+			result.Failures = append(result.Failures, *newError(revertErr))
+			continue
+		}
+		before, _ := flatten(entity.Before)
+		after, _ := flatten(entity.After)
+
+		if len(userChanges(before, currentFields)) == 0 {
+			continue
+		}
+
+		if changed := userChanges(after, currentFields); len(changed) > 0 {
+			fields := make([]string, len(changed))
+			for j, change := range changed {
+				fields[j] = change.Field
+			}
+			revertErr.Code = ErrCodeRevertConflict
+			revertErr.args = map[string]any{"fields": strings.Join(fields, ", ")}
+			result.Conflicts = append(result.Conflicts, *newError(revertErr))
+			continue
+		}
+
+		if err := svc.restoreEntity(context.Background(), entity.EntityType, entity.EntityId, entity.Before); err != nil {
+			log.Error(err)
+			revertErr.Code = ErrCodeRevertFailed
+			result.Failures = append(result.Failures, *newError(revertErr))
+			continue
+		}
+
+		if change, changed, err := entityChange(entity.EntityType, entity.EntityId, before, entity.After); err != nil {
+			log.Error(err)
+		} else if changed {
+			result.Reverted = append(result.Reverted, change)
+		}
+	}
+
+	if len(result.Conflicts) == 0 && len(result.Failures) == 0 {
+		now := time.Now()
+		record.RevertedAt = &now
+		if err := svc.historyStore.Save(record); err != nil {
+			log.Error(err)
+		}
+	}
+
+	return result, nil
+}
+
+// Reads the current state of an entity of the history
+func (svc *mappingService) readEntity(ctx context.Context, entityType string, id string) (any, error) {
+	switch entityType {
+	case "tariff":
+		return svc.tariffBackend().ReadContext(ctx, id)
+	case "hardware":
+		return svc.hardwareBackend().ReadContext(ctx, id)
+	}
+	return nil, errors.New("unknown entity type " + entityType)
+}
+
+// Writes the state of an entity recorded in the history
+func (svc *mappingService) restoreEntity(ctx context.Context, entityType string, id string, state json.RawMessage) error {
+	switch entityType {
+	case "tariff":
+		obj := &tariff.TariffCRUD{}
+		if err := json.Unmarshal(state, obj); err != nil {
+			return err
+		}
+		_, err := svc.tariffBackend().UpdateContext(ctx, id, obj)
+		return err
+	case "hardware":
+		obj := &hardware.HardwareCRUD{}
+		if err := json.Unmarshal(state, obj); err != nil {
+			return err
+		}
+		_, err := svc.hardwareBackend().UpdateContext(ctx, id, obj)
+		return err
+	}
+	return errors.New("unknown entity type " + entityType)
+}
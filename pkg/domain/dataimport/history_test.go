@@ -0,0 +1,228 @@
+package dataimport
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/crud"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONHistoryStore(t *testing.T) {
+	store := NewJSONHistoryStore(filepath.Join(t.TempDir(), "history"))
+
+	_, err := store.Get("0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = store.Get("../templates")
+	assert.ErrorIs(t, err, os.ErrNotExist, "only uuids are valid keys")
+
+	record := &ImportRecord{
+		Uuid:       "0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60",
+		User:       "m.mustermann",
+		UploadType: "tariff",
+		Entities: []EntityRecord{{
+			EntityType: "tariff",
+			EntityId:   "T-1",
+			Before:     json.RawMessage(`{"id":"T-1"}`),
+			After:      json.RawMessage(`{"id":"T-1","basicCharge":9.99}`),
+		}},
+	}
+	assert.NoError(t, store.Save(record))
+	assert.Error(t, store.Save(&ImportRecord{Uuid: "../templates"}))
+
+	loaded, err := store.Get(record.Uuid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "m.mustermann", loaded.User)
+		if assert.Len(t, loaded.Entities, 1) {
+			assert.JSONEq(t, `{"id":"T-1","basicCharge":9.99}`, string(loaded.Entities[0].After))
+		}
+	}
+}
+
+func TestRevertImport(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Provision"},
+		{"T-1", "50"},
+		{"T-2", "60"},
+		{"T-1", "70"},
+	})
+
+	stored := map[string]*tariff.TariffCRUD{
+		"T-1": {Id: "T-1", Provision: 10, XProvision: 1},
+		"T-2": {Id: "T-2", Provision: 20, XProvision: 2},
+	}
+	svc := &mappingService{
+		historyStore: NewJSONHistoryStore(t.TempDir()),
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return crud.Clone(stored[s])
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				stored[s] = tc
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "provision"},
+		},
+		UploadType: "tariff",
+		User:       "m.mustermann",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, result.SuccessfulRows)
+	}
+	assert.Equal(t, 70.0, stored["T-1"].Provision)
+
+	record, err := svc.historyStore.Get(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "m.mustermann", record.User)
+		assert.Equal(t, "tariff", record.UploadType)
+		assert.Len(t, record.Entities, 3)
+	}
+
+	// T-2 is edited after the import and must not be overwritten
+	stored["T-2"].XProvision = 5
+
+	revert, err := svc.RevertImport(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Len(t, revert.Reverted, 1, "T-1 is reverted once to its state before the first import")
+		if assert.Len(t, revert.Conflicts, 1) {
+			assert.Equal(t, ErrCodeRevertConflict, revert.Conflicts[0].Code)
+			assert.Equal(t, "T-2", revert.Conflicts[0].EntityId)
+			assert.Contains(t, revert.Conflicts[0].ErrMsg, "xProvision")
+		}
+	}
+	assert.Equal(t, 10.0, stored["T-1"].Provision)
+	assert.Equal(t, 60.0, stored["T-2"].Provision)
+
+	record, _ = svc.historyStore.Get(options.Uuid)
+	assert.Nil(t, record.RevertedAt, "imports with conflicts are not completely reverted")
+
+	// Once the conflict is resolved, the revert can be repeated
+	stored["T-2"].XProvision = 2
+
+	revert, err = svc.RevertImport(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Len(t, revert.Reverted, 1)
+		assert.Empty(t, revert.Conflicts)
+	}
+	assert.Equal(t, 10.0, stored["T-1"].Provision)
+	assert.Equal(t, 20.0, stored["T-2"].Provision)
+
+	record, _ = svc.historyStore.Get(options.Uuid)
+	assert.NotNil(t, record.RevertedAt)
+
+	_, err = svc.RevertImport("0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60")
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeImportNotFound, importErr.Code)
+	}
+
+	_, err = (&mappingService{}).RevertImport(options.Uuid)
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeHistoryDisabled, importErr.Code)
+	}
+}
+
+func TestRevertImportServerTimestamps(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Provision"},
+		{"T-1", "50"},
+		{"T-2", "60"},
+	})
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := created
+	stored := map[string]*tariff.TariffCRUD{
+		"T-1": {Id: "T-1", Provision: 10, CreatedAt: &created, UpdatedAt: &created},
+		"T-2": {Id: "T-2", Provision: 20, CreatedAt: &created, UpdatedAt: &created},
+	}
+	svc := &mappingService{
+		historyStore: NewJSONHistoryStore(t.TempDir()),
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return crud.Clone(stored[s])
+			},
+			// Like the backend, every write bumps updatedAt of the entity returned
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				written, err := crud.Clone(tc)
+				if err != nil {
+					return nil, err
+				}
+				clock = clock.Add(time.Minute)
+				updatedAt := clock
+				written.UpdatedAt = &updatedAt
+				stored[s] = written
+				return crud.Clone(written)
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	_, err = svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "provision"},
+		},
+		UploadType: "tariff",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	record, err := svc.historyStore.Get(options.Uuid)
+	if assert.NoError(t, err) && assert.Len(t, record.Entities, 2) {
+		var after tariff.TariffCRUD
+		if assert.NoError(t, json.Unmarshal(record.Entities[0].After, &after)) {
+			assert.Equal(t, stored["T-1"].UpdatedAt, after.UpdatedAt, "the state returned by the backend is recorded")
+		}
+	}
+
+	// T-2 was written again by someone else, only its timestamp tells
+	bumped := clock.Add(time.Hour)
+	stored["T-2"].UpdatedAt = &bumped
+
+	revert, err := svc.RevertImport(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Empty(t, revert.Conflicts, "server-managed timestamps aren't conflicts")
+		assert.Len(t, revert.Reverted, 2)
+	}
+	assert.Equal(t, 10.0, stored["T-1"].Provision)
+	assert.Equal(t, 20.0, stored["T-2"].Provision)
+
+	// The restore bumped updatedAt again, the entities are still recognized as reverted
+	revert, err = svc.RevertImport(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Empty(t, revert.Conflicts)
+		assert.Empty(t, revert.Failures)
+		assert.Empty(t, revert.Reverted)
+	}
+}
@@ -0,0 +1,253 @@
+package dataimport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Languages messages and labels are available in. German is the fallback for all other locales.
+const (
+	LocaleGerman  = "de"
+	LocaleEnglish = "en"
+)
+
+type message struct {
+	title string
+	text  string
+}
+
+// Error messages keyed by locale and error code. Placeholders like {row} are filled from the context
+// fields of the Error ({row}, {column}, {cellRef}, {field}, {value}, {entityId}) and its message args.
+var errorMessages = map[string]map[ErrorCode]message{
+	LocaleGerman: {
+		ErrCodeBadRequest:           {"Ungültige Anfrage", "{reason}"},
+		ErrCodeInternal:             {"Interner Fehler", "Die Anfrage konnte nicht verarbeitet werden."},
+		ErrCodeCancelled:            {"Abgebrochen", "Die Verarbeitung wurde abgebrochen."},
+		ErrCodeStorageFailed:        {"Speicherfehler", "Die Datei konnte nicht gespeichert oder gelesen werden."},
+		ErrCodeFileParseFailed:      {"Parsingfehler", "Datei konnte nicht verarbeitet werden und ist möglicherweise korrupt."},
+		ErrCodeUploadNotFound:       {"Upload nicht vorhanden", "Für den Upload {uuid} liegt keine Datei vor oder sie wurde bereits gelöscht."},
+		ErrCodeUuidInvalid:          {"Ungültige UUID", "'{uuid}' ist keine gültige UUID."},
+		ErrCodeSessionExpired:       {"Sitzung abgelaufen", "Die Sitzung des Uploads {uuid} ist abgelaufen. Bitte die Datei erneut hochladen."},
+		ErrCodeUploadExists:         {"Upload bereits vorhanden", "Es gibt bereits einen Upload {uuid}. Bitte die Datei ohne oder mit einer neuen uuid hochladen."},
+		ErrCodeUploadImported:       {"Upload bereits importiert", "Der Upload {uuid} wurde bereits importiert. Für einen weiteren Import bitte die Datei erneut hochladen."},
+		ErrCodeUploadTooLarge:       {"Datei zu groß", "Die Datei überschreitet die maximale Größe von {maxSize}."},
+		ErrCodeRequestTooLarge:      {"Anfrage zu groß", "Die Anfrage überschreitet die maximale Größe von {maxSize}."},
+		ErrCodeUncompressedTooLarge: {"Datei zu groß", "Der entpackte Inhalt der Datei überschreitet die maximale Größe von {maxSize}."},
+		ErrCodeTooManySheets:        {"Zu viele Arbeitsblätter", "Die Datei enthält {sheets} Arbeitsblätter, erlaubt sind höchstens {maxSheets}."},
+		ErrCodeTooManyRows:          {"Zu viele Zeilen", "Das Arbeitsblatt '{sheet}' enthält mehr als {maxRows} Zeilen."},
+		ErrCodeTooManyColumns:       {"Zu viele Spalten", "Die Zeile {row} des Arbeitsblatts '{sheet}' enthält mehr als {maxColumns} Spalten."},
+		ErrCodeUploadTypeUnknown:    {"Fehlender/falscher Uploadtyp", "Der Uploadtyp '{uploadType}' ist unbekannt."},
+		ErrCodeNoSheets:             {"Fehlerhafte Excel-Datei", "Datei enthält keine Arbeitsblätter"},
+		ErrCodeSheetNotFound:        {"Arbeitsblatt unbekannt", "Die Datei enthält kein Arbeitsblatt '{sheet}'"},
+		ErrCodeHeaderRowEmpty:       {"Leerzeile", "Die Zeile {row} der Datei ist leer. Diese muss für den Import die Tabellenköpfe enthalten."},
+		ErrCodeInvalidDataRange:     {"Ungültiger Datenbereich", "Der Datenbereich (Zeile {first} bis {last}) muss unterhalb der Tabellenköpfe in Zeile {headerRow} liegen."},
+		ErrCodeMappingFieldUnknown:  {"Unbekannte Zuordnung", "Die Zuordnung '{field}' ist für den Uploadtyp '{uploadType}' nicht verfügbar."},
+		ErrCodeNumberFormatUnknown:  {"Unbekanntes Zahlenformat", "Das Zahlenformat '{numberFormat}' ist unbekannt. Möglich sind 'de' und 'en'."},
+		ErrCodeEmptyCellsUnknown:    {"Unbekannte Behandlung leerer Zellen", "Die Behandlung leerer Zellen '{emptyCells}' für '{field}' ist unbekannt. Möglich sind 'keep', 'clear' und 'error'."},
+		ErrCodeIdentifierMissing:    {"Fehlende EbootisID / externe Artikelnummer", "Keine der Spalten wurde der EbootisID / externen Artikelnummer zugewiesen"},
+		ErrCodeCellReadFailed:       {"Lesefehler", "Fehler in Zeile {row}, Spalte {column}. Der Wert der Zelle konnte nicht gelesen werden."},
+		ErrCodeCellParseFailed:      {"Ungültiger Wert", "Fehler in Zeile {row}, Spalte {column}. Der Wert '{value}' der Zelle {cellRef} ist für '{field}' ungültig."},
+		ErrCodeCellEmpty:            {"Leere Zelle", "Fehler in Zeile {row}, Spalte {column}. Die Zelle {cellRef} für '{field}' darf nicht leer sein."},
+		ErrCodeLookupFailed:         {"Identifizierungs-Fehler", "Fehler in Zeile {row}. Zum Identifikator '{value}' konnten keine Daten ermittelt werden."},
+		ErrCodeIdentifierNotFound:   {"Variante unbekannt", "Es konnte keine Variante mit dem Identifikator '{value}' gefunden werden"},
+		ErrCodeUpdateFailed:         {"Aktualisierungsfehler", "Update von {entityId} konnte nicht durchgeführt werden"},
+		ErrCodeRollbackFailed:       {"Zurücksetzen fehlgeschlagen", "{entityId} konnte nicht auf den Stand vor dem Import zurückgesetzt werden"},
+		ErrCodeReportNotFound:       {"Fehlerdatei nicht vorhanden", "Für den Upload {uuid} liegt keine Fehlerdatei vor oder sie wurde bereits gelöscht."},
+		ErrCodeTemplatesDisabled:    {"Vorlagen nicht verfügbar", "Für diesen Dienst ist keine Vorlagenablage konfiguriert."},
+		ErrCodeTemplateInvalid:      {"Ungültige Vorlage", "Die Vorlage benötigt einen Namen sowie die Tabellenköpfe oder deren Signatur."},
+		ErrCodeTemplateStoreFailed:  {"Vorlagenfehler", "Die Vorlagen konnten nicht geladen oder gespeichert werden."},
+		ErrCodeHistoryDisabled:      {"Importhistorie nicht verfügbar", "Für diesen Dienst ist keine Importhistorie konfiguriert."},
+		ErrCodeHistoryStoreFailed:   {"Historienfehler", "Die Importhistorie konnte nicht geladen oder gespeichert werden."},
+		ErrCodeImportNotFound:       {"Import nicht vorhanden", "Zum Import {uuid} liegt kein Eintrag in der Importhistorie vor."},
+		ErrCodeRevertConflict:       {"Konflikt beim Rückgängigmachen", "{entityId} wurde nach dem Import geändert ({fields}) und wird nicht zurückgesetzt."},
+		ErrCodeRevertFailed:         {"Rückgängigmachen fehlgeschlagen", "{entityId} konnte nicht auf den Stand vor dem Import zurückgesetzt werden"},
+		ErrCodeJobNotFound:          {"Importauftrag nicht vorhanden", "Zum Upload {uuid} läuft kein Import im Hintergrund oder er ist bereits abgelaufen."},
+		ErrCodeJobRunning:           {"Import läuft bereits", "Der Upload {uuid} wird bereits im Hintergrund importiert."},
+	},
+	LocaleEnglish: {
+		ErrCodeBadRequest:           {"Invalid request", "{reason}"},
+		ErrCodeInternal:             {"Internal error", "The request could not be processed."},
+		ErrCodeCancelled:            {"Cancelled", "The processing was cancelled."},
+		ErrCodeStorageFailed:        {"Storage error", "The file could not be stored or read."},
+		ErrCodeFileParseFailed:      {"Parsing error", "The file could not be processed and may be corrupt."},
+		ErrCodeUploadNotFound:       {"Upload not found", "There is no file for upload {uuid} or it has already been deleted."},
+		ErrCodeUuidInvalid:          {"Invalid UUID", "'{uuid}' is not a valid UUID."},
+		ErrCodeSessionExpired:       {"Session expired", "The session of upload {uuid} has expired. Please upload the file again."},
+		ErrCodeUploadExists:         {"Upload already exists", "There already is an upload {uuid}. Please upload the file without or with a new uuid."},
+		ErrCodeUploadImported:       {"Upload already imported", "Upload {uuid} has already been imported. Please upload the file again to import it once more."},
+		ErrCodeUploadTooLarge:       {"File too large", "The file exceeds the maximum size of {maxSize}."},
+		ErrCodeRequestTooLarge:      {"Request too large", "The request exceeds the maximum size of {maxSize}."},
+		ErrCodeUncompressedTooLarge: {"File too large", "The unpacked content of the file exceeds the maximum size of {maxSize}."},
+		ErrCodeTooManySheets:        {"Too many sheets", "The file contains {sheets} sheets, at most {maxSheets} are allowed."},
+		ErrCodeTooManyRows:          {"Too many rows", "Sheet '{sheet}' contains more than {maxRows} rows."},
+		ErrCodeTooManyColumns:       {"Too many columns", "Row {row} of sheet '{sheet}' contains more than {maxColumns} columns."},
+		ErrCodeUploadTypeUnknown:    {"Missing/wrong upload type", "The upload type '{uploadType}' is unknown."},
+		ErrCodeNoSheets:             {"Faulty Excel file", "The file contains no sheets"},
+		ErrCodeSheetNotFound:        {"Unknown sheet", "The file contains no sheet '{sheet}'"},
+		ErrCodeHeaderRowEmpty:       {"Empty row", "Row {row} of the file is empty. It has to contain the table headers for the import."},
+		ErrCodeInvalidDataRange:     {"Invalid data range", "The data range (row {first} to {last}) has to be below the table headers in row {headerRow}."},
+		ErrCodeMappingFieldUnknown:  {"Unknown mapping", "The mapping '{field}' is not available for upload type '{uploadType}'."},
+		ErrCodeNumberFormatUnknown:  {"Unknown number format", "The number format '{numberFormat}' is unknown. Possible are 'de' and 'en'."},
+		ErrCodeEmptyCellsUnknown:    {"Unknown empty cell handling", "The empty cell handling '{emptyCells}' for '{field}' is unknown. Possible are 'keep', 'clear' and 'error'."},
+		ErrCodeIdentifierMissing:    {"Missing EbootisID / external article number", "None of the columns was mapped to the EbootisID / external article number"},
+		ErrCodeCellReadFailed:       {"Read error", "Error in row {row}, column {column}. The value of the cell could not be read."},
+		ErrCodeCellParseFailed:      {"Invalid value", "Error in row {row}, column {column}. The value '{value}' of cell {cellRef} is invalid for '{field}'."},
+		ErrCodeCellEmpty:            {"Empty cell", "Error in row {row}, column {column}. The cell {cellRef} for '{field}' must not be empty."},
+		ErrCodeLookupFailed:         {"Identification error", "Error in row {row}. No data could be determined for the identifier '{value}'."},
+		ErrCodeIdentifierNotFound:   {"Unknown variant", "No variant with the identifier '{value}' could be found"},
+		ErrCodeUpdateFailed:         {"Update error", "Update of {entityId} could not be carried out"},
+		ErrCodeRollbackFailed:       {"Rollback failed", "{entityId} could not be restored to its state before the import"},
+		ErrCodeReportNotFound:       {"Error file not found", "There is no error file for upload {uuid} or it has already been deleted."},
+		ErrCodeTemplatesDisabled:    {"Templates unavailable", "No template store is configured for this service."},
+		ErrCodeTemplateInvalid:      {"Invalid template", "The template needs a name as well as the table headers or their signature."},
+		ErrCodeTemplateStoreFailed:  {"Template error", "The templates could not be loaded or stored."},
+		ErrCodeHistoryDisabled:      {"Import history unavailable", "No import history is configured for this service."},
+		ErrCodeHistoryStoreFailed:   {"History error", "The import history could not be loaded or stored."},
+		ErrCodeImportNotFound:       {"Import not found", "There is no entry for import {uuid} in the import history."},
+		ErrCodeRevertConflict:       {"Revert conflict", "{entityId} was changed after the import ({fields}) and is not restored."},
+		ErrCodeRevertFailed:         {"Revert failed", "{entityId} could not be restored to its state before the import"},
+		ErrCodeJobNotFound:          {"Import job not found", "There is no background import of upload {uuid} or it has already expired."},
+		ErrCodeJobRunning:           {"Import already running", "Upload {uuid} is already being imported in the background."},
+	},
+}
+
+// Texts of the reasons of ErrBadRequest keyed by locale
+var badRequestReasons = map[string]map[BadRequestReason]string{
+	LocaleGerman: {
+		ReasonNotMultipart:       "Die Anfrage muss als multipart/form-data gesendet werden.",
+		ReasonFileMissing:        "Es wurde keine Datei im Feld 'file' übermittelt.",
+		ReasonHeaderRowInvalid:   "Die Kopfzeile muss als Zeilennummer angegeben werden.",
+		ReasonMappingUnreadable:  "Die Mapping-Anweisung konnte nicht gelesen werden.",
+		ReasonTemplateUnreadable: "Die Vorlage konnte nicht gelesen werden.",
+	},
+	LocaleEnglish: {
+		ReasonNotMultipart:       "The request must be sent as multipart/form-data.",
+		ReasonFileMissing:        "No file was sent in the field 'file'.",
+		ReasonHeaderRowInvalid:   "The header row must be given as row number.",
+		ReasonMappingUnreadable:  "The mapping instruction could not be read.",
+		ReasonTemplateUnreadable: "The template could not be read.",
+	},
+}
+
+// Field labels keyed by locale and field key. German labels are declared in the field registries.
+var fieldLabels = map[string]map[string]string{
+	LocaleEnglish: {
+		"ebootisId":             "EbootisId",
+		"externalArticleNumber": "External article no.",
+		"basicCharge":           "Monthly price",
+		"basicChargeRenewal":    "Monthly price after promotion period",
+		"leadType":              "Lead type",
+		"provision":             "Market bonus",
+		"xProvision":            "Online bonus",
+		"connectionFee":         "Connection fee (without EUR sign)",
+		"dataVolume":            "Incl. data volume in GB",
+		"legalNote":             "Legal note",
+		"pibLink":               "PIB URL",
+		"highlight1":            "Highlight 1",
+		"highlight2":            "Highlight 2",
+		"highlight3":            "Highlight 3",
+		"highlight4":            "Highlight 4",
+		"highlight5":            "Highlight 5",
+		"bullet1":               "Inclusive benefit 1",
+		"bullet2":               "Inclusive benefit 2",
+		"bullet3":               "Inclusive benefit 3",
+		"bullet4":               "Inclusive benefit 4",
+		"bullet5":               "Inclusive benefit 5",
+		"bullet6":               "Inclusive benefit 6",
+		"supplierWkz":           "Supplier WKZ",
+		"tariffWkz":             "Tariff WKZ",
+		"price":                 "Purchase price",
+		"manufactWkz":           "Manufacturer WKZ",
+		"ek24Wkz":               "ek24 WKZ",
+		"currentStock":          "Current stock",
+		"originalStock":         "Original stock",
+	},
+}
+
+// Texts of the status column of the error report
+type reportText struct {
+	header string
+	ok     string
+	failed string
+}
+
+var reportTexts = map[string]reportText{
+	LocaleGerman:  {header: "Importstatus", ok: "OK", failed: "Fehler"},
+	LocaleEnglish: {header: "Import status", ok: "OK", failed: "Error"},
+}
+
+// Reduces a locale like "en-US" or "en_GB" to a supported language, German if unsupported or empty
+func normalizeLocale(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	if _, ok := errorMessages[lang]; ok {
+		return lang
+	}
+	return LocaleGerman
+}
+
+// Renders ErrTitle and ErrMsg in the language of the locale, falling back to German. Message args that are
+// BadRequestReasons are rendered in the language of the locale as well. Errors with unknown code keep their texts.
+func (err *Error) Localize(locale string) *Error {
+	locale = normalizeLocale(locale)
+	msg, ok := errorMessages[locale][err.Code]
+	if !ok {
+		if msg, ok = errorMessages[LocaleGerman][err.Code]; !ok {
+			return err
+		}
+	}
+
+	placeholders := []string{
+		"{row}", strconv.Itoa(err.Row),
+		"{column}", strconv.Itoa(err.Column),
+		"{cellRef}", err.CellRef,
+		"{field}", err.Field,
+		"{value}", err.RawValue,
+		"{entityId}", err.EntityId,
+	}
+	for key, val := range err.args {
+		if reason, ok := val.(BadRequestReason); ok {
+			val = badRequestReasons[locale][reason]
+		}
+		placeholders = append(placeholders, "{"+key+"}", fmt.Sprint(val))
+	}
+
+	replacer := strings.NewReplacer(placeholders...)
+	err.ErrTitle = replacer.Replace(msg.title)
+	err.ErrMsg = replacer.Replace(msg.text)
+	return err
+}
+
+// Localizes err if it is an *Error. Other errors are returned unchanged.
+func localizeError(err error, locale string) error {
+	var importErr *Error
+	if errors.As(err, &importErr) {
+		importErr.Localize(locale)
+	}
+	return err
+}
+
+// Returns the error rendered in German. Used wherever errors are built, so they carry texts even if never localized.
+func newError(err Error) *Error {
+	return err.Localize(LocaleGerman)
+}
+
+// Dropdown options of the upload type with labels in the language of the locale, falling back to German
+func localizedDropdownOptions(uploadType string, locale string) (map[string]string, bool) {
+	options, ok := DROPDOWN_OPTIONS[uploadType]
+	if !ok {
+		return nil, false
+	}
+
+	labels := fieldLabels[normalizeLocale(locale)]
+	result := make(map[string]string, len(options))
+	for key, label := range options {
+		if translated, ok := labels[key]; ok {
+			label = translated
+		}
+		result[key] = label
+	}
+	return result, true
+}
@@ -0,0 +1,127 @@
+package dataimport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"":      LocaleGerman,
+		"de":    LocaleGerman,
+		"de-AT": LocaleGerman,
+		"en":    LocaleEnglish,
+		"en-US": LocaleEnglish,
+		"EN_gb": LocaleEnglish,
+		"fr":    LocaleGerman,
+	}
+
+	for locale, expected := range tests {
+		assert.Equal(t, expected, normalizeLocale(locale), locale)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	err := newError(Error{Code: ErrCodeSheetNotFound, args: map[string]any{"sheet": "Bestand"}})
+	assert.Equal(t, "Arbeitsblatt unbekannt", err.ErrTitle)
+	assert.Equal(t, "Die Datei enthält kein Arbeitsblatt 'Bestand'", err.ErrMsg)
+
+	err.Localize("en")
+	assert.Equal(t, "Unknown sheet", err.ErrTitle)
+	assert.Equal(t, "The file contains no sheet 'Bestand'", err.ErrMsg)
+
+	err.Localize("fr")
+	assert.Equal(t, "Arbeitsblatt unbekannt", err.ErrTitle, "unsupported locales fall back to German")
+
+	custom := (&Error{Code: "CUSTOM", ErrTitle: "Titel", ErrMsg: "Nachricht"}).Localize("en")
+	assert.Equal(t, "Nachricht", custom.ErrMsg, "errors without catalog entry keep their texts")
+}
+
+func TestErrBadRequest(t *testing.T) {
+	err := ErrBadRequest(ReasonFileMissing)
+	assert.Equal(t, "Ungültige Anfrage", err.ErrTitle)
+	assert.Equal(t, "Es wurde keine Datei im Feld 'file' übermittelt.", err.ErrMsg)
+
+	err.Localize("en-GB")
+	assert.Equal(t, "Invalid request", err.ErrTitle)
+	assert.Equal(t, "No file was sent in the field 'file'.", err.ErrMsg)
+}
+
+func TestErrorMessagesComplete(t *testing.T) {
+	for code := range errorMessages[LocaleGerman] {
+		assert.Contains(t, errorMessages[LocaleEnglish], code)
+	}
+
+	for reason := range badRequestReasons[LocaleGerman] {
+		assert.Contains(t, badRequestReasons[LocaleEnglish], reason)
+	}
+
+	for _, fields := range uploadTypeFields {
+		for key := range fields.dropdownOptions() {
+			assert.Contains(t, fieldLabels[LocaleEnglish], key)
+		}
+	}
+}
+
+func TestReadFileLocale(t *testing.T) {
+	svc := mappingService{}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(newTestWorkbook(t, [][]string{{"ArtNr", "Bestand"}, {"31161", "12"}})),
+		UploadType:   "stocks",
+		Locale:       "en-US",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Current stock", options.DropdownOptions["currentStock"])
+		assert.Equal(t, "Stock aktuell", DROPDOWN_OPTIONS["stocks"]["currentStock"], "German labels stay untouched")
+	}
+
+	_, err = svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte{}),
+		UploadType:   "stocks",
+		Locale:       "en",
+	})
+	if customErr, ok := err.(*Error); assert.True(t, ok) {
+		assert.Equal(t, "Parsing error", customErr.ErrTitle)
+	}
+}
+
+func TestWriteMappingLocale(t *testing.T) {
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return &hardware.HardwareCRUD{Id: "hw1"}, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(newTestWorkbook(t, [][]string{{"ArtNr", "Bestand"}, {"99999", "3"}})),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+		Locale:     "en",
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, result.FailedRows, 1) {
+		assert.Equal(t, "Unknown variant", result.FailedRows[0].ErrTitle)
+		assert.Equal(t, "No variant with the identifier '99999' could be found", result.FailedRows[0].ErrMsg)
+	}
+}
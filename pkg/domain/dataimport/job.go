@@ -0,0 +1,221 @@
+package dataimport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Time finished jobs can still be queried via MappingService.JobStatus
+const jobRetention = 30 * time.Minute
+
+// Import started as background job via MappingInstruction.Async, keyed by the upload uuid
+type importJob struct {
+	mu          sync.Mutex
+	status      JobStatus
+	cancel      context.CancelFunc
+	subscribers map[chan JobStatus]struct{}
+	done        chan struct{}
+}
+
+func newImportJob(uploadUuid string, cancel context.CancelFunc) *importJob {
+	return &importJob{
+		status:      JobStatus{Uuid: uploadUuid, State: JobRunning, StartedAt: time.Now()},
+		cancel:      cancel,
+		subscribers: make(map[chan JobStatus]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Sets the number of rows to be processed. Does nothing for imports not running as job, as do all other methods.
+func (job *importJob) begin(totalRows int) {
+	if job == nil {
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.TotalRows = totalRows
+	job.publish()
+}
+
+// Counts a processed row with the counters of the result so far
+func (job *importJob) advance(result *MappingResult) {
+	if job == nil {
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.ProcessedRows++
+	job.status.SuccessfulRows = result.SuccessfulRows
+	job.status.UnsuccessfulRows = result.UnsuccessfulRows
+	job.publish()
+}
+
+// Records the outcome of the import and closes all subscriptions
+func (job *importJob) finish(result *MappingResult, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.status.State = JobDone
+	job.status.Result = result
+	if result != nil {
+		job.status.SuccessfulRows = result.SuccessfulRows
+		job.status.UnsuccessfulRows = result.UnsuccessfulRows
+	}
+
+	if err != nil {
+		job.status.State = JobFailed
+		var importErr *Error
+		if !errors.As(err, &importErr) {
+			importErr = newError(Error{Code: ErrCodeInternal})
+		}
+		job.status.Error = importErr
+	}
+
+	job.publish()
+	for ch := range job.subscribers {
+		close(ch)
+	}
+	job.subscribers = nil
+	close(job.done)
+}
+
+func (job *importJob) snapshot() JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.current()
+}
+
+// Returns the status including the estimated completion. Callers must hold mu.
+func (job *importJob) current() JobStatus {
+	status := job.status
+	if status.State == JobRunning && status.ProcessedRows > 0 && status.TotalRows >= status.ProcessedRows {
+		perRow := time.Since(status.StartedAt) / time.Duration(status.ProcessedRows)
+		completion := time.Now().Add(perRow * time.Duration(status.TotalRows-status.ProcessedRows))
+		status.EstimatedCompletion = &completion
+	}
+	return status
+}
+
+// Passes the status to all subscribers. Slow subscribers only receive the latest status. Callers must hold mu.
+func (job *importJob) publish() {
+	status := job.current()
+	for ch := range job.subscribers {
+		select {
+		case ch <- status:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- status
+		}
+	}
+}
+
+// Returns a channel receiving the current status and every change of it. Closed once the job is finished.
+func (job *importJob) subscribe() (chan JobStatus, func()) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	ch := make(chan JobStatus, 1)
+	ch <- job.current()
+
+	if job.subscribers == nil {
+		close(ch)
+		return ch, func() {}
+	}
+
+	job.subscribers[ch] = struct{}{}
+	unsubscribe := func() {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		if _, ok := job.subscribers[ch]; ok {
+			delete(job.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Starts the import in the background. Invalid instructions are reported by the status of the job.
+// The job keeps running if ctx is cancelled, it is stopped via MappingService.CancelJob.
+func (svc *mappingService) startJob(ctx context.Context, mi *MappingInstruction) (*MappingResult, error) {
+	if !validUuid(mi.Uuid) {
+		return nil, newError(Error{Code: ErrCodeUploadNotFound, args: map[string]any{"uuid": mi.Uuid}})
+	}
+
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := newImportJob(mi.Uuid, cancel)
+
+	// Finished jobs of the upload are replaced, e.g. by the commit after a dry run
+	if existing, loaded := svc.jobs.LoadOrStore(mi.Uuid, job); loaded {
+		if existing.(*importJob).snapshot().State == JobRunning || !svc.jobs.CompareAndSwap(mi.Uuid, existing, job) {
+			cancel()
+			return nil, newError(Error{Code: ErrCodeJobRunning, args: map[string]any{"uuid": mi.Uuid}})
+		}
+	}
+
+	go func() {
+		defer cancel()
+
+		result, err := svc.writeMapping(jobCtx, mi, job)
+		job.finish(result, localizeError(err, mi.Locale))
+
+		time.AfterFunc(jobRetention, func() {
+			svc.jobs.CompareAndDelete(mi.Uuid, job)
+		})
+	}()
+
+	status := job.snapshot()
+	return &MappingResult{Job: &status}, nil
+}
+
+func (svc *mappingService) job(uploadUuid string) (*importJob, error) {
+	if job, ok := svc.jobs.Load(uploadUuid); ok {
+		return job.(*importJob), nil
+	}
+	return nil, newError(Error{Code: ErrCodeJobNotFound, args: map[string]any{"uuid": uploadUuid}})
+}
+
+func (svc *mappingService) JobStatus(uploadUuid string) (*JobStatus, error) {
+	job, err := svc.job(uploadUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	status := job.snapshot()
+	return &status, nil
+}
+
+// Streams the status of the job until it is finished or ctx is done
+func (svc *mappingService) WatchJob(ctx context.Context, uploadUuid string) (<-chan JobStatus, error) {
+	job, err := svc.job(uploadUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, unsubscribe := job.subscribe()
+	go func() {
+		select {
+		case <-ctx.Done():
+			unsubscribe()
+		case <-job.done:
+		}
+	}()
+	return ch, nil
+}
+
+// Stops the job like a cancelled WriteMappingContext, its partial result is reported by JobStatus
+func (svc *mappingService) CancelJob(uploadUuid string) error {
+	job, err := svc.job(uploadUuid)
+	if err != nil {
+		return err
+	}
+
+	job.cancel()
+	return nil
+}
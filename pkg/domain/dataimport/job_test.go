@@ -0,0 +1,164 @@
+package dataimport
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+// Service whose tariff updates wait for release, so the job can be observed while running
+func blockingTariffService(release <-chan struct{}) *mappingService {
+	return &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				<-release
+				return tc, nil
+			},
+		},
+	}
+}
+
+func startTestJob(t *testing.T, svc *mappingService) string {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr"},
+		{"T-1", "29,99"},
+		{"T-2", "39,99"},
+		{"T-3", "49,99"},
+	})
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	mi := &MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+		},
+		UploadType: "tariff",
+		Async:      true,
+	}
+
+	result, err := svc.WriteMapping(mi)
+	if err != nil {
+		t.Fatalf("WriteMapping failed: %v", err)
+	}
+	if assert.NotNil(t, result.Job) {
+		assert.Equal(t, JobRunning, result.Job.State)
+	}
+
+	_, err = svc.WriteMapping(mi)
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr, "uploads can't be imported twice at once") {
+		assert.Equal(t, ErrCodeJobRunning, importErr.Code)
+	}
+
+	return options.Uuid
+}
+
+func TestWriteMappingAsync(t *testing.T) {
+	release := make(chan struct{})
+	svc := blockingTariffService(release)
+	uploadUuid := startTestJob(t, svc)
+
+	updates, err := svc.WatchJob(context.Background(), uploadUuid)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	release <- struct{}{}
+
+	var last JobStatus
+	for status := range updates {
+		if status.State == JobRunning && status.ProcessedRows == 1 {
+			assert.Equal(t, 3, status.TotalRows)
+			assert.Equal(t, 1, status.SuccessfulRows)
+			assert.NotNil(t, status.EstimatedCompletion)
+			close(release)
+		}
+		last = status
+	}
+
+	assert.Equal(t, JobDone, last.State)
+	assert.Equal(t, 3, last.ProcessedRows)
+	if assert.NotNil(t, last.Result) {
+		assert.Equal(t, 3, last.Result.SuccessfulRows)
+	}
+
+	status, err := svc.JobStatus(uploadUuid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, JobDone, status.State)
+		assert.Nil(t, status.EstimatedCompletion)
+	}
+
+	_, err = svc.JobStatus("0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60")
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeJobNotFound, importErr.Code)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	release := make(chan struct{})
+	svc := blockingTariffService(release)
+	uploadUuid := startTestJob(t, svc)
+
+	release <- struct{}{}
+	assert.NoError(t, svc.CancelJob(uploadUuid))
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		status, err := svc.JobStatus(uploadUuid)
+		return err == nil && status.State != JobRunning
+	}, time.Second, 5*time.Millisecond)
+
+	status, _ := svc.JobStatus(uploadUuid)
+	assert.Equal(t, JobDone, status.State)
+	if assert.NotNil(t, status.Result) {
+		assert.True(t, status.Result.Cancelled)
+		assert.Less(t, status.Result.SuccessfulRows, 3)
+	}
+}
+
+func TestWriteMappingAsyncFailed(t *testing.T) {
+	svc := &mappingService{}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid:       "6c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f",
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}},
+		UploadType: "tariff",
+		Async:      true,
+		Locale:     LocaleEnglish,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	updates, err := svc.WatchJob(context.Background(), result.Job.Uuid)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var last JobStatus
+	for status := range updates {
+		last = status
+	}
+
+	assert.Equal(t, JobFailed, last.State)
+	if assert.NotNil(t, last.Error) {
+		assert.Equal(t, ErrCodeUploadNotFound, last.Error.Code)
+		assert.Equal(t, "Upload not found", last.Error.ErrTitle)
+	}
+}
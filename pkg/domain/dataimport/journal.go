@@ -0,0 +1,63 @@
+package dataimport
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Entities written by an import along with their state before it, in order of writing
+type importJournal struct {
+	entries []journalEntry
+}
+
+type journalEntry struct {
+	entityType string
+	entityId   string
+	before     any                         // snapshot of the state before the import
+	after      any                         // state written by the import, as returned by the backend
+	restore    func(context.Context) error // writes the state before the import back
+}
+
+func (j *importJournal) record(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+// State of an entity after it was written, as returned by the backend including fields it maintains itself, e.g.
+// updatedAt. The state sent is taken if the backend doesn't return the entity.
+func writtenState[T any](written *T, sent *T) *T {
+	if written != nil {
+		return written
+	}
+	return sent
+}
+
+// Restores all entities of the journal in reverse order of writing, so entities written more than once end up
+// in their state before the first write. Reverted changes and failed restores are reported in the result.
+func rollback(ctx context.Context, journal *importJournal, result *MappingResult, locale string) {
+	result.RolledBack = true
+
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+
+		if err := entry.restore(ctx); err != nil {
+			log.Error(err)
+			rollbackErr := newError(Error{Code: ErrCodeRollbackFailed, EntityId: entry.entityId})
+			result.RollbackFailures = append(result.RollbackFailures, *rollbackErr.Localize(locale))
+			continue
+		}
+
+		before, err := flatten(entry.before)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		change, changed, err := entityChange(entry.entityType, entry.entityId, before, entry.after)
+		if err != nil {
+			log.Error(err)
+		}
+		if changed {
+			result.Reverted = append(result.Reverted, change)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package dataimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+)
+
+// Bounds of the uploads accepted by ReadFile. Zero values are replaced by the according value of
+// DefaultUploadLimits, negative values disable the limit.
+type UploadLimits struct {
+	// Size of the uploaded file
+	MaxBytes int64
+	// Total size of the unpacked parts of an xlsx upload, guarding against zip bombs
+	MaxUncompressedBytes int64
+	MaxSheets            int
+	// Rows per sheet, including empty rows in between
+	MaxRows int
+	// Columns per row, including empty cells in between
+	MaxColumns int
+}
+
+var DefaultUploadLimits = UploadLimits{
+	MaxBytes:             20 << 20,
+	MaxUncompressedBytes: 200 << 20,
+	MaxSheets:            50,
+	MaxRows:              100000,
+	MaxColumns:           500,
+}
+
+func (limits UploadLimits) withDefaults() UploadLimits {
+	if limits.MaxBytes == 0 {
+		limits.MaxBytes = DefaultUploadLimits.MaxBytes
+	}
+	if limits.MaxUncompressedBytes == 0 {
+		limits.MaxUncompressedBytes = DefaultUploadLimits.MaxUncompressedBytes
+	}
+	if limits.MaxSheets == 0 {
+		limits.MaxSheets = DefaultUploadLimits.MaxSheets
+	}
+	if limits.MaxRows == 0 {
+		limits.MaxRows = DefaultUploadLimits.MaxRows
+	}
+	if limits.MaxColumns == 0 {
+		limits.MaxColumns = DefaultUploadLimits.MaxColumns
+	}
+	return limits
+}
+
+// Error of uploads exceeding maxBytes, also for uploads rejected before they reach ReadFile
+func ErrUploadTooLarge(maxBytes int64) *Error {
+	return newError(Error{Code: ErrCodeUploadTooLarge, args: map[string]any{"maxSize": formatBytes(maxBytes)}})
+}
+
+// Error of request bodies other than uploads exceeding maxBytes
+func ErrRequestTooLarge(maxBytes int64) *Error {
+	return newError(Error{Code: ErrCodeRequestTooLarge, args: map[string]any{"maxSize": formatBytes(maxBytes)}})
+}
+
+func exceeds[N int | int64](value N, limit N) bool {
+	return limit > 0 && value > limit
+}
+
+// Renders a size for messages in the largest unit it is a multiple of, e.g. "20 MB"
+func formatBytes(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	unit := 0
+	for size >= 1024 && size%1024 == 0 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%d %s", size, units[unit])
+}
+
+// Sums the sizes of the parts of an xlsx upload before it is unpacked. The sizes are taken from the zip headers,
+// archive/zip refuses to unpack more than they declare. Data which isn't a zip archive is left to the parser.
+func (limits UploadLimits) checkUncompressed(data []byte) *Error {
+	if limits.MaxUncompressedBytes <= 0 || !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+
+	var total uint64
+	for _, part := range archive.File {
+		total += part.UncompressedSize64
+		if total > uint64(limits.MaxUncompressedBytes) {
+			return newError(Error{Code: ErrCodeUncompressedTooLarge, args: map[string]any{"maxSize": formatBytes(limits.MaxUncompressedBytes)}})
+		}
+	}
+	return nil
+}
+
+// Checks the number of sheets, rows and columns of the parsed upload. Reads every sheet once.
+func (limits UploadLimits) checkTable(file tableSource) *Error {
+	sheets := file.GetSheetList()
+	if exceeds(len(sheets), limits.MaxSheets) {
+		return newError(Error{Code: ErrCodeTooManySheets, args: map[string]any{"sheets": len(sheets), "maxSheets": limits.MaxSheets}})
+	}
+
+	if limits.MaxRows <= 0 && limits.MaxColumns <= 0 {
+		return nil
+	}
+
+	for _, sheet := range sheets {
+		if err := limits.checkSheet(file, sheet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (limits UploadLimits) checkSheet(file tableSource, sheet string) *Error {
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return newError(Error{Code: ErrCodeFileParseFailed})
+	}
+	defer rows.Close()
+
+	for row := 1; rows.Next(); row++ {
+		if exceeds(row, limits.MaxRows) {
+			return newError(Error{Code: ErrCodeTooManyRows, args: map[string]any{"sheet": sheet, "maxRows": limits.MaxRows}})
+		}
+		if limits.MaxColumns <= 0 {
+			continue
+		}
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return newError(Error{Code: ErrCodeFileParseFailed})
+		}
+		if exceeds(len(cols), limits.MaxColumns) {
+			return newError(Error{Code: ErrCodeTooManyColumns, Row: row, args: map[string]any{"sheet": sheet, "maxColumns": limits.MaxColumns}})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package dataimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+// Zip archive looking like an xlsx, whose only part unpacks to size zero bytes
+func newZipBomb(t *testing.T, size int) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.BestCompression)
+	})
+
+	part, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatalf("Creating zip bomb failed: %v", err)
+	}
+	if _, err := part.Write(make([]byte, size)); err != nil {
+		t.Fatalf("Creating zip bomb failed: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Creating zip bomb failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Workbook with a single cell at the given coordinates, so all rows and columns before it count as well
+func newSparseWorkbook(t *testing.T, sheets int, cell string) []byte {
+	t.Helper()
+
+	file := excelize.NewFile()
+	defer file.Close()
+
+	for i := 2; i <= sheets; i++ {
+		if _, err := file.NewSheet(fmt.Sprintf("Sheet%d", i)); err != nil {
+			t.Fatalf("Creating test .xlsx failed: %v", err)
+		}
+	}
+	if err := file.SetCellValue("Sheet1", "A1", "EbootisId"); err != nil {
+		t.Fatalf("Creating test .xlsx failed: %v", err)
+	}
+	if err := file.SetCellValue("Sheet1", cell, "x"); err != nil {
+		t.Fatalf("Creating test .xlsx failed: %v", err)
+	}
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("Creating test .xlsx failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadFileLimits(t *testing.T) {
+	csvRows := func(rows int, cols int) []byte {
+		line := strings.Repeat("1;", cols-1) + "1\n"
+		return []byte(strings.Repeat(line, rows))
+	}
+
+	tests := []struct {
+		name     string
+		upload   []byte
+		limits   UploadLimits
+		expected ErrorCode
+	}{
+		{
+			name:     "bytes",
+			upload:   csvRows(200, 10),
+			limits:   UploadLimits{MaxBytes: 1 << 10},
+			expected: ErrCodeUploadTooLarge,
+		},
+		{
+			name:   "bytes at limit",
+			upload: csvRows(64, 8),
+			limits: UploadLimits{MaxBytes: 1 << 10},
+		},
+		{
+			name:     "zip bomb",
+			upload:   newZipBomb(t, 16<<20),
+			limits:   UploadLimits{MaxUncompressedBytes: 8 << 20},
+			expected: ErrCodeUncompressedTooLarge,
+		},
+		{
+			name:     "sheets",
+			upload:   newSparseWorkbook(t, 4, "B2"),
+			limits:   UploadLimits{MaxSheets: 3},
+			expected: ErrCodeTooManySheets,
+		},
+		{
+			name:     "csv rows",
+			upload:   csvRows(101, 2),
+			limits:   UploadLimits{MaxRows: 100},
+			expected: ErrCodeTooManyRows,
+		},
+		{
+			name:     "sparse rows",
+			upload:   newSparseWorkbook(t, 1, "A5000"),
+			limits:   UploadLimits{MaxRows: 1000},
+			expected: ErrCodeTooManyRows,
+		},
+		{
+			name:     "csv columns",
+			upload:   csvRows(2, 21),
+			limits:   UploadLimits{MaxColumns: 20},
+			expected: ErrCodeTooManyColumns,
+		},
+		{
+			name:     "sparse columns",
+			upload:   newSparseWorkbook(t, 1, "XFD1"),
+			expected: ErrCodeTooManyColumns,
+		},
+		{
+			name:   "disabled",
+			upload: newSparseWorkbook(t, 1, "XFD1"),
+			limits: UploadLimits{MaxColumns: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &mappingService{uploadStore: NewMemoryUploadStore(), limits: tt.limits}
+
+			_, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(tt.upload), UploadType: "tariff"})
+			if tt.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var importErr *Error
+			if assert.ErrorAs(t, err, &importErr) {
+				assert.Equal(t, tt.expected, importErr.Code)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "20 MB", formatBytes(20<<20))
+	assert.Equal(t, "1536 KB", formatBytes(1536<<10))
+	assert.Equal(t, "1000 B", formatBytes(1000))
+}
@@ -0,0 +1,215 @@
+package dataimport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/crud"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	log "github.com/sirupsen/logrus"
+)
+
+// Number of identifiers resolved by a single bulk lookup
+const prefetchBatchSize = 50
+
+// Backends used by the rows of an import. Lookups are cached for the duration of the import, so rows sharing an
+// identifier or an entity don't repeat backend calls.
+type importLookups struct {
+	tariffs    *crud.Cache[tariff.TariffCRUD, tariff.TariffLookup]
+	hardware   *crud.Cache[hardware.HardwareCRUD, hardware.HardwareLookup]
+	prefetched int
+}
+
+func (svc *mappingService) newImportLookups() *importLookups {
+	return &importLookups{
+		tariffs:  crud.NewCache(svc.tariffBackend()),
+		hardware: crud.NewCache(svc.hardwareBackend()),
+	}
+}
+
+func (lookups *importLookups) stats() LookupStats {
+	tariffs, hardware := lookups.tariffs.Stats(), lookups.hardware.Stats()
+	return LookupStats{
+		Hits:       tariffs.Hits + hardware.Hits,
+		Misses:     tariffs.Misses + hardware.Misses,
+		Prefetched: lookups.prefetched,
+	}
+}
+
+// Name of the list filter finding the entities of an identifier
+func identifierFilter(uploadType string, idType string) string {
+	switch {
+	case uploadType == "tariff":
+		return "ebootis_id"
+	case idType == "externalArticleNumber":
+		return "variants.external_articlenumber"
+	}
+	return "variants.ebootis_id"
+}
+
+// Reports whether the backend of the upload type can resolve identifiers in bulk
+func (svc *mappingService) canPrefetch(uploadType string) bool {
+	if uploadType == "tariff" {
+		return crud.SupportsInFilter(svc.tariffAdapter)
+	}
+	return crud.SupportsInFilter(svc.hardwareAdapter)
+}
+
+// Returns the distinct identifiers of the rows to import in order of their first row. Identifiers containing commas
+// can't be part of an In filter and are left out.
+func collectIdentifiers(file tableSource, sheet string, idCol int, firstRow int, lastRow int, stopAtEmptyRow bool) []string {
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var identifiers []string
+	for row := 1; rows.Next(); row++ {
+		if lastRow > 0 && row > lastRow {
+			break
+		}
+		if row < firstRow {
+			continue
+		}
+
+		cols, err := rows.Columns()
+		if err != nil {
+			continue
+		}
+		if stopAtEmptyRow && isEmptyRow(cols) {
+			break
+		}
+
+		identifier := cellAt(cols, idCol)
+		if identifier == "" || strings.Contains(identifier, ",") || seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers
+}
+
+// Lists the identifiers in batches via In filters. Results are stored in the caches of the import as if each
+// identifier was listed on its own, so its rows find them there. Tariffs are told apart by the ebootis id of their
+// lookup, hardware is read to tell which of its variants were found, by as many workers as process the rows.
+// Identifiers without a match, e.g. because the backend normalises values, and those of failed batches are looked
+// up by their rows as usual.
+func (svc *mappingService) prefetch(ctx context.Context, lookups *importLookups, uploadType string, idType string, identifiers []string) {
+	filter := identifierFilter(uploadType, idType)
+
+	for start := 0; start < len(identifiers); start += prefetchBatchSize {
+		if ctx.Err() != nil {
+			return
+		}
+		batch := identifiers[start:min(start+prefetchBatchSize, len(identifiers))]
+
+		var prefetched int
+		var err error
+		if uploadType == "tariff" {
+			prefetched, err = prefetchBatch(ctx, lookups.tariffs, filter, batch, 1,
+				func(ctx context.Context, lookup *tariff.TariffLookup) ([]string, error) {
+					return []string{lookup.EbootisId}, nil
+				},
+			)
+		} else {
+			prefetched, err = prefetchBatch(ctx, lookups.hardware, filter, batch, svc.workers,
+				func(ctx context.Context, lookup *hardware.HardwareLookup) ([]string, error) {
+					// Cached for the rows of the hardware
+					obj, err := lookups.hardware.ReadContext(ctx, lookup.Id)
+					if err != nil {
+						return nil, err
+					}
+					return variantIdentifiers(obj, idType), nil
+				},
+			)
+		}
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		lookups.prefetched += prefetched
+	}
+}
+
+// Lists the entities of all identifiers of the batch at once and stores the list of each identifier of the batch
+// that matched. identifiersOf tells the identifiers an entity found belongs to, run by the given number of workers.
+// Returns the number of identifiers stored.
+func prefetchBatch[T, L any](ctx context.Context, cache *crud.Cache[T, L], filter string, batch []string, workers int, identifiersOf func(context.Context, *L) ([]string, error)) (int, error) {
+	found, err := cache.ListContext(ctx, crud.In(filter, batch...))
+	if err != nil {
+		return 0, err
+	}
+
+	identifiers := make([][]string, len(found))
+	errs := make([]error, len(found))
+	forEachConcurrently(len(found), workers, func(i int) {
+		identifiers[i], errs[i] = identifiersOf(ctx, found[i])
+	})
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+
+	matches := make(map[string][]*L, len(batch))
+	for i, lookup := range found {
+		for _, identifier := range identifiers[i] {
+			matches[identifier] = append(matches[identifier], lookup)
+		}
+	}
+
+	prefetched := 0
+	for _, identifier := range batch {
+		if len(matches[identifier]) == 0 {
+			continue
+		}
+		cache.StoreList(matches[identifier], settings.Option{Name: filter, Value: identifier})
+		prefetched++
+	}
+	return prefetched, nil
+}
+
+// Calls fn for 0 to n-1 with up to the given number of goroutines, one after another if at most one
+func forEachConcurrently(n int, workers int, fn func(int)) {
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Identifiers of the given type of all variants of the hardware
+func variantIdentifiers(obj *hardware.HardwareCRUD, idType string) []string {
+	identifiers := make([]string, 0, len(obj.Variants))
+	for _, variant := range obj.Variants {
+		if idType == "externalArticleNumber" {
+			identifiers = append(identifiers, variant.ExternalArticleNumber)
+		} else {
+			identifiers = append(identifiers, variant.EbootisId)
+		}
+	}
+	return identifiers
+}
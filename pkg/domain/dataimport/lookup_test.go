@@ -0,0 +1,217 @@
+package dataimport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+// crudMock of a backend reporting whether it understands "__in" filters
+type inFilterMock[T, L any] struct {
+	crudMock[T, L]
+	unsupported bool
+}
+
+func (svc *inFilterMock[T, L]) SupportsInFilter() bool {
+	return !svc.unsupported
+}
+
+// Tariff upload listing T-1 three times
+var lookupTestRows = [][]string{
+	{"EbootisId", "Grundgebühr"},
+	{"T-1", "9,99"},
+	{"T-2", "19,99"},
+	{"T-1", "9,99"},
+	{"T-1", "9,99"},
+}
+
+func runLookupTestImport(t *testing.T, svc *mappingService) *MappingResult {
+	t.Helper()
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(newTestWorkbook(t, lookupTestRows)), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+		},
+		UploadType: "tariff",
+	})
+	if err != nil {
+		t.Fatalf("WriteMapping failed: %v", err)
+	}
+	return result
+}
+
+func TestWriteMappingLookupCache(t *testing.T) {
+	lists, reads := 0, 0
+	svc := &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				lists++
+				return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				reads++
+				return &tariff.TariffCRUD{Id: s, EbootisId: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return tc, nil
+			},
+		},
+	}
+
+	result := runLookupTestImport(t, svc)
+	assert.Equal(t, 4, result.SuccessfulRows)
+	assert.Equal(t, 2, lists, "every identifier is listed once")
+	assert.Equal(t, 2, reads, "every tariff is read once")
+	assert.Equal(t, LookupStats{Hits: 4, Misses: 4}, result.Lookups)
+}
+
+func TestWriteMappingLookupPrefetch(t *testing.T) {
+	var filters []settings.Option
+	reads := 0
+	adapter := &inFilterMock[tariff.TariffCRUD, tariff.TariffLookup]{}
+	adapter.list = func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+		filters = append(filters, o...)
+		var found []*tariff.TariffLookup
+		for _, identifier := range strings.Split(o[0].StringValue(), ",") {
+			found = append(found, &tariff.TariffLookup{Id: identifier, EbootisId: identifier})
+		}
+		return found, nil
+	}
+	adapter.read = func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		reads++
+		return &tariff.TariffCRUD{Id: s, EbootisId: s}, nil
+	}
+	adapter.update = func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return tc, nil
+	}
+	svc := &mappingService{tariffAdapter: adapter}
+
+	result := runLookupTestImport(t, svc)
+	assert.Equal(t, 4, result.SuccessfulRows)
+	assert.Equal(t, []settings.Option{{Name: "ebootis_id__in", Value: "T-1,T-2"}}, filters, "identifiers are listed in a single bulk lookup")
+	assert.Equal(t, 2, reads, "tariffs are read by their rows, not before the import")
+	assert.Equal(t, LookupStats{Hits: 6, Misses: 3, Prefetched: 2}, result.Lookups, "rows find their lookups prefetched")
+}
+
+func TestWriteMappingLookupPrefetchNormalised(t *testing.T) {
+	var filters []settings.Option
+	adapter := &inFilterMock[tariff.TariffCRUD, tariff.TariffLookup]{}
+	adapter.list = func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+		filters = append(filters, o...)
+		// Backend matching case-insensitively and answering with its own spelling
+		var found []*tariff.TariffLookup
+		for _, identifier := range strings.Split(o[0].StringValue(), ",") {
+			found = append(found, &tariff.TariffLookup{Id: identifier, EbootisId: strings.ToLower(identifier)})
+		}
+		return found, nil
+	}
+	adapter.read = func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return &tariff.TariffCRUD{Id: s, EbootisId: s}, nil
+	}
+	adapter.update = func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return tc, nil
+	}
+	svc := &mappingService{tariffAdapter: adapter}
+
+	// Identifiers the bulk lookup can't be matched to are listed by their rows instead of caching them as not found
+	result := runLookupTestImport(t, svc)
+	assert.Equal(t, 4, result.SuccessfulRows)
+	assert.Equal(t, []settings.Option{
+		{Name: "ebootis_id__in", Value: "T-1,T-2"},
+		{Name: "ebootis_id", Value: "T-1"},
+		{Name: "ebootis_id", Value: "T-2"},
+	}, filters)
+	assert.Zero(t, result.Lookups.Prefetched)
+}
+
+func TestWriteMappingLookupNoInFilter(t *testing.T) {
+	var filters []settings.Option
+	adapter := &inFilterMock[tariff.TariffCRUD, tariff.TariffLookup]{unsupported: true}
+	adapter.list = func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+		filters = append(filters, o...)
+		return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+	}
+	adapter.read = func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return &tariff.TariffCRUD{Id: s, EbootisId: s}, nil
+	}
+	adapter.update = func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return tc, nil
+	}
+	svc := &mappingService{tariffAdapter: adapter}
+
+	// Backends turning In filters off are looked up row by row
+	result := runLookupTestImport(t, svc)
+	assert.Equal(t, 4, result.SuccessfulRows)
+	assert.Equal(t, []settings.Option{{Name: "ebootis_id", Value: "T-1"}, {Name: "ebootis_id", Value: "T-2"}}, filters)
+	assert.Zero(t, result.Lookups.Prefetched)
+}
+
+func TestWriteMappingLookupPrefetchHardware(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"ArtNr", "Bestand"},
+		{"31161", "12"},
+		{"37803", "3"},
+		{"99999", "1"},
+	})
+
+	var filters []settings.Option
+	adapter := &inFilterMock[hardware.HardwareCRUD, hardware.HardwareLookup]{}
+	adapter.list = func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+		filters = append(filters, o...)
+		if o[0].StringValue() == "99999" {
+			return nil, nil
+		}
+		return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+	}
+	adapter.read = func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+		return &hardware.HardwareCRUD{
+			Id: s,
+			Variants: []*hardware.VariantCRUD{
+				{EbootisId: "1000-1", ExternalArticleNumber: "31161"},
+				{EbootisId: "1000-2", ExternalArticleNumber: "37803"},
+			},
+		}, nil
+	}
+	adapter.update = func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+		return h, nil
+	}
+	svc := &mappingService{hardwareAdapter: adapter, workers: 4}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "stocks"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+	})
+	if err != nil {
+		t.Fatalf("WriteMapping failed: %v", err)
+	}
+
+	// The hardware has no variant of the last identifier, so its row looks it up on its own instead of finding
+	// hardware it doesn't belong to
+	assert.Equal(t, []settings.Option{
+		{Name: "variants.external_articlenumber__in", Value: "31161,37803,99999"},
+		{Name: "variants.external_articlenumber", Value: "99999"},
+	}, filters)
+	assert.Equal(t, 3, result.SuccessfulRows)
+	assert.Equal(t, 2, result.Lookups.Prefetched)
+	assert.Empty(t, result.FailedRows)
+}
@@ -1,8 +1,11 @@
 package dataimport
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
 )
@@ -12,41 +15,326 @@ type UploadData struct {
 	UploadedFile io.Reader
 	UploadType   string
 	Uuid         string
+	// Owner of the upload, recorded with its session
+	User string
+	// Sheet to take headers and samples from. Defaults to the first sheet.
+	Sheet string
+	// 1-based row holding the headers. Detected automatically if 0.
+	HeaderRow int
+	// Language of messages and dropdown labels, e.g. "en". Defaults to German.
+	Locale string
 }
 
 type MappingOptions struct {
-	DropdownOptions map[string]string
-	TableHeaders    []string
-	TableSummary    [][]string
-	Uuid            string
+	DropdownOptions map[string]string `json:"dropdownOptions"`
+	TableHeaders    []string          `json:"tableHeaders"`
+	TableSummary    [][]string        `json:"tableSummary"`
+	Uuid            string            `json:"uuid"`
+	// Sheet the headers and samples are taken from
+	Sheet string `json:"sheet"`
+	// 1-based row the headers are taken from, either requested or detected
+	HeaderRow int `json:"headerRow"`
+	// All sheets of the file with their first rows
+	Sheets []SheetPreview `json:"sheets"`
+	// Saved templates matching upload type and table headers
+	Templates []*MappingTemplate `json:"templates"`
+	// Suggested field per column, derived from headers and sample values
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+type SheetPreview struct {
+	Name string     `json:"name"`
+	Rows [][]string `json:"rows"`
+}
+
+// Suggested mapping of a column. Confidence ranges from 0 to 1.
+type Suggestion struct {
+	MappingObject
+	Confidence float64 `json:"confidence"`
 }
 
 // Instructions sent to BE after mapping in FE
 type MappingInstruction struct {
-	Mapping    []MappingObject
-	Uuid       string
-	UploadType string
+	Mapping    []MappingObject `json:"mapping"`
+	Uuid       string          `json:"uuid"`
+	UploadType string          `json:"uploadType"`
+	// Sheet to import. Defaults to the first sheet.
+	Sheet string `json:"sheet"`
+	// 1-based row holding the headers. Defaults to 1.
+	HeaderRow int `json:"headerRow"`
+	// 1-based first row to import. Defaults to the row below the headers.
+	FirstDataRow int `json:"firstDataRow"`
+	// 1-based last row to import. All rows are imported if 0.
+	LastDataRow int `json:"lastDataRow"`
+	// Stops the import at the first fully empty row, e.g. above a totals footer
+	StopAtEmptyRow bool `json:"stopAtEmptyRow"`
+	// Writes a copy of the upload with status column and highlighted failing cells, see MappingService.ErrorReport
+	AnnotateErrors bool `json:"annotateErrors"`
+	// Runs parsing and lookups without persisting. Affected entities are reported in MappingResult.Changes instead.
+	DryRun bool `json:"dryRun"`
+	// Language of messages and of the error report, e.g. "en". Defaults to German.
+	Locale string `json:"locale"`
+	// Leaves out fields whose cell can't be parsed instead of rejecting the whole row.
+	// The left out cells are reported in MappingResult.SkippedFields.
+	SkipInvalidFields bool `json:"skipInvalidFields"`
+	// Separators of the numbers in the upload ("de" or "en"). Detected per value if empty. Applies to csv uploads
+	// and text cells of xlsx uploads, number cells are read independent of it.
+	NumberFormat NumberFormat `json:"numberFormat"`
+	// Imports all rows or none. Once more rows failed than MaxFailedRows, the import stops and all entities
+	// written so far are restored to their state before the import.
+	Transactional bool `json:"transactional"`
+	// Failed rows tolerated by transactional imports. The first failed row rolls the import back if 0.
+	MaxFailedRows int `json:"maxFailedRows"`
+	// Who started the import, kept in its ImportRecord
+	User string `json:"user"`
+	// Runs the import as background job. WriteMapping returns right away, the progress is reported by
+	// MappingService.JobStatus.
+	Async bool `json:"async"`
+}
+
+// Named mapping which can be reused for uploads with the same upload type and table headers
+type MappingTemplate struct {
+	Name       string `json:"name"`
+	UploadType string `json:"uploadType"`
+	// Computed from Headers via HeaderSignature if empty
+	HeaderSignature string          `json:"headerSignature"`
+	Headers         []string        `json:"headers,omitempty"`
+	Mapping         []MappingObject `json:"mapping"`
+	// Separators of the numbers in uploads of this kind, applied together with the mapping
+	NumberFormat NumberFormat `json:"numberFormat,omitempty"`
 }
 
 type MappingObject struct {
-	ColIndex     int
-	MappingValue string
+	ColIndex     int    `json:"colIndex"`
+	MappingValue string `json:"mappingValue"`
+	// Handling of empty cells of the column. Defaults to "keep" for numeric fields, "clear" for all others.
+	EmptyCells EmptyCellPolicy `json:"emptyCells,omitempty"`
+}
+
+type EmptyCellPolicy string
+
+const (
+	EmptyCellsDefault EmptyCellPolicy = ""
+	// Leaves the current value of the field untouched
+	EmptyCellsKeep EmptyCellPolicy = "keep"
+	// Resets the field, e.g. to "" or 0. Bullets and WKZ are removed.
+	EmptyCellsClear EmptyCellPolicy = "clear"
+	// Reports the empty cell as error of the row
+	EmptyCellsError EmptyCellPolicy = "error"
+)
+
+func (policy EmptyCellPolicy) valid() bool {
+	switch policy {
+	case EmptyCellsDefault, EmptyCellsKeep, EmptyCellsClear, EmptyCellsError:
+		return true
+	}
+	return false
 }
 
 type MappingResult struct {
-	SuccessfulRows   int
-	UnsuccessfulRows int
-	FailedRows       []Error
+	SuccessfulRows   int     `json:"successfulRows"`
+	UnsuccessfulRows int     `json:"unsuccessfulRows"`
+	FailedRows       []Error `json:"failedRows"`
+	// Cells left out because of MappingInstruction.SkipInvalidFields
+	SkippedFields []Error `json:"skippedFields,omitempty"`
+	// Only filled on dry runs
+	Changes []EntityChange `json:"changes,omitempty"`
+	// Annotated copy of the upload can be downloaded via MappingService.ErrorReport
+	ErrorReport bool `json:"errorReport"`
+	// Set if a transactional import was rolled back, see MappingInstruction.Transactional
+	RolledBack bool `json:"rolledBack"`
+	// Changes undone by the rollback
+	Reverted []EntityChange `json:"reverted,omitempty"`
+	// Entities which couldn't be restored by the rollback and remain in their imported state
+	RollbackFailures []Error `json:"rollbackFailures,omitempty"`
+	// Set if the import was cancelled before all rows were processed. Rows up to then are reported as usual.
+	// Hardware is written once all rows are processed, so hardware of a cancelled import isn't written at all.
+	Cancelled bool `json:"cancelled"`
+	// Status of the background job right after it was started, see MappingInstruction.Async
+	Job *JobStatus `json:"job,omitempty"`
+	// Backend lookups answered by the cache of the import
+	Lookups LookupStats `json:"lookups"`
+}
+
+// Lookups of an import, see MappingResult.Lookups. Every entity is looked up once per import, further rows with
+// the same identifier or entity are hits.
+type LookupStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+	// Identifiers listed in bulk before the rows were processed. Identifiers the bulk lookup found nothing for are
+	// listed by their rows and not counted.
+	Prefetched int `json:"prefetched"`
+}
+
+type JobState string
+
+const (
+	JobRunning JobState = "running"
+	JobDone    JobState = "done"
+	JobFailed  JobState = "failed"
+)
+
+// Progress of an import running as background job
+type JobStatus struct {
+	Uuid  string   `json:"uuid"`
+	State JobState `json:"state"`
+	// Rows of the data range. Upper bound if the import stops at the first empty row.
+	TotalRows        int       `json:"totalRows"`
+	ProcessedRows    int       `json:"processedRows"`
+	SuccessfulRows   int       `json:"successfulRows"`
+	UnsuccessfulRows int       `json:"unsuccessfulRows"`
+	StartedAt        time.Time `json:"startedAt"`
+	// Extrapolated from the rows processed so far, only while running
+	EstimatedCompletion *time.Time `json:"estimatedCompletion,omitempty"`
+	// Set once the job is done, a cancelled job carries its partial result
+	Result *MappingResult `json:"result,omitempty"`
+	// Set if the job failed
+	Error *Error `json:"error,omitempty"`
+}
+
+// Field-level diff of a TariffCRUD/HardwareCRUD that would be written by the mapping
+type EntityChange struct {
+	EntityType string        `json:"entityType"`
+	EntityId   string        `json:"entityId"`
+	Fields     []FieldChange `json:"fields"`
+}
+
+type FieldChange struct {
+	Field    string `json:"field"`
+	OldValue any    `json:"oldValue"`
+	NewValue any    `json:"newValue"`
+}
+
+// Completed import as kept in the HistoryStore, see MappingService.RevertImport
+type ImportRecord struct {
+	Uuid       string          `json:"uuid"`
+	User       string          `json:"user"`
+	UploadType string          `json:"uploadType"`
+	Mapping    []MappingObject `json:"mapping"`
+	Timestamp  time.Time       `json:"timestamp"`
+	// Entities in order of writing
+	Entities []EntityRecord `json:"entities"`
+	// Set if the import was rolled back right away, see MappingInstruction.Transactional
+	RolledBack bool `json:"rolledBack"`
+	// Set once all entities were reverted
+	RevertedAt *time.Time `json:"revertedAt,omitempty"`
+}
+
+// JSON of a TariffCRUD/HardwareCRUD before and after it was written by an import
+type EntityRecord struct {
+	EntityType string          `json:"entityType"`
+	EntityId   string          `json:"entityId"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+type RevertResult struct {
+	// Changes of the import which were undone
+	Reverted []EntityChange `json:"reverted"`
+	// Entities changed after the import, left in their current state
+	Conflicts []Error `json:"conflicts,omitempty"`
+	// Entities which couldn't be read or restored
+	Failures []Error `json:"failures,omitempty"`
+}
+
+// Mapped cell of a row together with its parsed value
+type cellValue struct {
+	MappingObject
+	raw string
+	val any
+	// Cell is empty and the field is to be reset, see EmptyCellsClear
+	clear bool
 }
 
 type editedCRUDobj struct {
+	load         sync.Mutex // guards reading the hardware, see mappingService.editedHardware
 	hardwareCRUD *hardware.HardwareCRUD
 	hasError     bool
+	original     map[string]any         // flattened state as read from hardwareAdapter
+	snapshot     *hardware.HardwareCRUD // copy of the state as read from hardwareAdapter
+	rows         []int                  // rows the hardware was edited by
 }
 
 type Error struct {
-	ErrTitle string
-	ErrMsg   string
+	// Stable, machine-readable kind of the error, see the ErrorCode constants
+	Code     ErrorCode `json:"code"`
+	ErrTitle string    `json:"errTitle"`
+	ErrMsg   string    `json:"errMsg"`
+	// Location of the failing cell. Row errors without column refer to the identifier of the row.
+	Row     int    `json:"row,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	CellRef string `json:"cellRef,omitempty"`
+	// Mapped field and the cell value it failed for
+	Field    string `json:"field,omitempty"`
+	RawValue string `json:"rawValue,omitempty"`
+	// Id of the TariffCRUD/HardwareCRUD the error occurred for
+	EntityId string `json:"entityId,omitempty"`
+	// Further values of the message placeholders, see errorMessages
+	args map[string]any
+}
+
+type ErrorCode string
+
+const (
+	ErrCodeBadRequest           ErrorCode = "BAD_REQUEST"
+	ErrCodeInternal             ErrorCode = "INTERNAL"
+	ErrCodeCancelled            ErrorCode = "CANCELLED"
+	ErrCodeStorageFailed        ErrorCode = "STORAGE_FAILED"
+	ErrCodeFileParseFailed      ErrorCode = "FILE_PARSE_FAILED"
+	ErrCodeUploadNotFound       ErrorCode = "UPLOAD_NOT_FOUND"
+	ErrCodeUuidInvalid          ErrorCode = "UUID_INVALID"
+	ErrCodeSessionExpired       ErrorCode = "SESSION_EXPIRED"
+	ErrCodeUploadImported       ErrorCode = "UPLOAD_IMPORTED"
+	ErrCodeUploadExists         ErrorCode = "UPLOAD_EXISTS"
+	ErrCodeUploadTooLarge       ErrorCode = "UPLOAD_TOO_LARGE"
+	ErrCodeRequestTooLarge      ErrorCode = "REQUEST_TOO_LARGE"
+	ErrCodeUncompressedTooLarge ErrorCode = "UNCOMPRESSED_TOO_LARGE"
+	ErrCodeTooManySheets        ErrorCode = "TOO_MANY_SHEETS"
+	ErrCodeTooManyRows          ErrorCode = "TOO_MANY_ROWS"
+	ErrCodeTooManyColumns       ErrorCode = "TOO_MANY_COLUMNS"
+	ErrCodeUploadTypeUnknown    ErrorCode = "UPLOAD_TYPE_UNKNOWN"
+	ErrCodeNoSheets             ErrorCode = "NO_SHEETS"
+	ErrCodeSheetNotFound        ErrorCode = "SHEET_NOT_FOUND"
+	ErrCodeHeaderRowEmpty       ErrorCode = "HEADER_ROW_EMPTY"
+	ErrCodeInvalidDataRange     ErrorCode = "INVALID_DATA_RANGE"
+	ErrCodeMappingFieldUnknown  ErrorCode = "MAPPING_FIELD_UNKNOWN"
+	ErrCodeNumberFormatUnknown  ErrorCode = "NUMBER_FORMAT_UNKNOWN"
+	ErrCodeEmptyCellsUnknown    ErrorCode = "EMPTY_CELLS_UNKNOWN"
+	ErrCodeIdentifierMissing    ErrorCode = "IDENTIFIER_MISSING"
+	ErrCodeCellReadFailed       ErrorCode = "CELL_READ_FAILED"
+	ErrCodeCellParseFailed      ErrorCode = "CELL_PARSE_FAILED"
+	ErrCodeCellEmpty            ErrorCode = "CELL_EMPTY"
+	ErrCodeLookupFailed         ErrorCode = "LOOKUP_FAILED"
+	ErrCodeIdentifierNotFound   ErrorCode = "IDENTIFIER_NOT_FOUND"
+	ErrCodeUpdateFailed         ErrorCode = "UPDATE_FAILED"
+	ErrCodeRollbackFailed       ErrorCode = "ROLLBACK_FAILED"
+	ErrCodeReportNotFound       ErrorCode = "REPORT_NOT_FOUND"
+	ErrCodeTemplatesDisabled    ErrorCode = "TEMPLATES_DISABLED"
+	ErrCodeTemplateInvalid      ErrorCode = "TEMPLATE_INVALID"
+	ErrCodeTemplateStoreFailed  ErrorCode = "TEMPLATE_STORE_FAILED"
+	ErrCodeHistoryDisabled      ErrorCode = "HISTORY_DISABLED"
+	ErrCodeHistoryStoreFailed   ErrorCode = "HISTORY_STORE_FAILED"
+	ErrCodeImportNotFound       ErrorCode = "IMPORT_NOT_FOUND"
+	ErrCodeRevertConflict       ErrorCode = "REVERT_CONFLICT"
+	ErrCodeRevertFailed         ErrorCode = "REVERT_FAILED"
+	ErrCodeJobNotFound          ErrorCode = "JOB_NOT_FOUND"
+	ErrCodeJobRunning           ErrorCode = "JOB_RUNNING"
+)
+
+// Why a request was rejected as malformed, see ErrBadRequest. Rendered in the language of the error.
+type BadRequestReason string
+
+const (
+	ReasonNotMultipart       BadRequestReason = "notMultipart"
+	ReasonFileMissing        BadRequestReason = "fileMissing"
+	ReasonHeaderRowInvalid   BadRequestReason = "headerRowInvalid"
+	ReasonMappingUnreadable  BadRequestReason = "mappingUnreadable"
+	ReasonTemplateUnreadable BadRequestReason = "templateUnreadable"
+)
+
+// Error of requests that are malformed rather than carrying faulty data
+func ErrBadRequest(reason BadRequestReason) *Error {
+	return newError(Error{Code: ErrCodeBadRequest, args: map[string]any{"reason": reason}})
 }
 
 func (err *Error) Error() string {
@@ -68,3 +356,25 @@ func (mi *MappingInstruction) GetIdentifierIndex() (exists bool, idIndex int, id
 	}
 	return
 }
+
+// Returns the 1-based first and last data row to import. last is 0 if all rows up to the end are imported.
+func (mi *MappingInstruction) DataRange() (first int, last int, err *Error) {
+	headerRow := mi.HeaderRow
+	if headerRow <= 0 {
+		headerRow = 1
+	}
+
+	first = mi.FirstDataRow
+	if first <= 0 {
+		first = headerRow + 1
+	}
+
+	if first <= headerRow || (mi.LastDataRow > 0 && mi.LastDataRow < first) {
+		return 0, 0, newError(Error{
+			Code: ErrCodeInvalidDataRange,
+			args: map[string]any{"first": first, "last": mi.LastDataRow, "headerRow": headerRow},
+		})
+	}
+
+	return first, mi.LastDataRow, nil
+}
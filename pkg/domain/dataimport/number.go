@@ -0,0 +1,279 @@
+package dataimport
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Convention of decimal and thousands separators of the numbers in an upload
+type NumberFormat string
+
+const (
+	// Detects the separators per value. A single separator is taken as decimal separator, e.g. "29,99" or "29.99".
+	NumberFormatAuto NumberFormat = ""
+	// "1.299,00". A single "." not followed by exactly three digits is still taken as decimal point, e.g. raw cell values like "29.99".
+	NumberFormatGerman NumberFormat = "de"
+	// "1,299.00". A single "," not followed by exactly three digits is still taken as decimal comma, e.g. "29,99".
+	NumberFormatEnglish NumberFormat = "en"
+)
+
+func (format NumberFormat) valid() bool {
+	switch format {
+	case NumberFormatAuto, NumberFormatGerman, NumberFormatEnglish:
+		return true
+	}
+	return false
+}
+
+func errNumberFormatUnknown(format NumberFormat) *Error {
+	return newError(Error{Code: ErrCodeNumberFormatUnknown, args: map[string]any{"numberFormat": format}})
+}
+
+var errInvalidNumber = errors.New("invalid number")
+
+// Unit of a numeric field. Only currency symbols and units of the field's unit are accepted in its cells.
+type numberUnit int
+
+const (
+	// Plain numbers without any symbol, e.g. stocks
+	unitNone numberUnit = iota
+	// Amounts in EUR. Other currencies are rejected, they'd need an exchange rate.
+	unitEuro
+	// Data volumes in GB. Other data units are converted.
+	unitGigabyte
+	// Percentages, returned as written, "19 %" is 19
+	unitPercent
+)
+
+type numberAffix struct {
+	affix string
+	unit  numberUnit
+	// Converts a number given in the affix into the unit
+	factor float64
+}
+
+// Currency symbols, currency codes and units which may precede or follow a number. Compared case-insensitively.
+// Longer affixes come first, so "euro" is stripped as a whole instead of leaving "o" behind.
+// Data volumes are converted with 1 GB = 1024 MB, as tariffs are advertised.
+var numberAffixes = []numberAffix{
+	{affix: "euro", unit: unitEuro, factor: 1},
+	{affix: "eur", unit: unitEuro, factor: 1},
+	{affix: "€", unit: unitEuro, factor: 1},
+	{affix: "tb", unit: unitGigabyte, factor: 1024},
+	{affix: "gb", unit: unitGigabyte, factor: 1},
+	{affix: "mb", unit: unitGigabyte, factor: 1.0 / 1024},
+	{affix: "%", unit: unitPercent, factor: 1},
+}
+
+// Raw numeric cell values as written by excelize, e.g. "1.5E-05"
+var scientificNumber = regexp.MustCompile(`^\d+(\.\d+)?[eE][+-]?\d+$`)
+
+// Parses a number as found in spreadsheets, e.g. "1.299,00", "€ 29,99", "29.99 EUR", "500 MB" or "1.5E-05".
+// Whitespace (including non-breaking spaces) and apostrophes are ignored. A single currency symbol or unit is
+// accepted if it belongs to unit, the number is converted into unit, e.g. "500 MB" is 0.48828125 for unitGigabyte.
+func parseNumber(s string, format NumberFormat, unit numberUnit) (float64, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' || r == '’' {
+			return -1
+		}
+		return r
+	}, s)
+
+	s, affix, err := stripNumberAffix(s, nil)
+	if err != nil {
+		return 0, err
+	}
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	case strings.HasSuffix(s, "-"): // trailing minus as exported by some ERP systems, e.g. "29,99-"
+		negative = true
+		s = s[:len(s)-1]
+	}
+	if s, affix, err = stripNumberAffix(s, affix); err != nil {
+		return 0, err
+	}
+
+	if s == "" {
+		return 0, errInvalidNumber
+	}
+
+	var val float64
+	if scientificNumber.MatchString(s) {
+		var err error
+		if val, err = strconv.ParseFloat(s, 64); err != nil {
+			return 0, errInvalidNumber
+		}
+	} else {
+		normalized, err := normalizeNumber(s, format)
+		if err != nil {
+			return 0, err
+		}
+		if val, err = strconv.ParseFloat(normalized, 64); err != nil {
+			return 0, errInvalidNumber
+		}
+	}
+
+	if negative {
+		val = -val
+	}
+	if affix != nil {
+		if affix.unit != unit {
+			return 0, fmt.Errorf("%w: %q doesn't fit the field", errInvalidNumber, affix.affix)
+		}
+		val *= affix.factor
+	}
+	return val, nil
+}
+
+// Parses a whole number, see parseNumber. Numbers with fractional digits other than 0 are rejected.
+func parseInteger(s string, format NumberFormat, unit numberUnit) (int, error) {
+	val, err := parseNumber(s, format, unit)
+	if err != nil {
+		return 0, err
+	}
+	if val != math.Trunc(val) || math.Abs(val) > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: %s is not a whole number", errInvalidNumber, s)
+	}
+	return int(val), nil
+}
+
+// Strips a leading or trailing currency symbol or unit. Numbers may only have one, found is the one stripped
+// before, if any.
+func stripNumberAffix(s string, found *numberAffix) (string, *numberAffix, error) {
+	lower := strings.ToLower(s)
+	for i, affix := range numberAffixes {
+		var stripped string
+		switch {
+		case strings.HasPrefix(lower, affix.affix):
+			stripped = s[len(affix.affix):]
+		case strings.HasSuffix(lower, affix.affix):
+			stripped = s[:len(s)-len(affix.affix)]
+		default:
+			continue
+		}
+
+		if found != nil {
+			return "", nil, errInvalidNumber
+		}
+		return stripped, &numberAffixes[i], nil
+	}
+	return s, found, nil
+}
+
+// Returns the number as written in the cell without its currency symbol or unit, e.g. "29,99" of "29,99 €"
+func stripNumberUnit(s string) string {
+	s = strings.TrimFunc(s, unicode.IsSpace)
+	stripped, affix, err := stripNumberAffix(s, nil)
+	if err != nil || affix == nil {
+		return s
+	}
+	return strings.TrimFunc(stripped, unicode.IsSpace)
+}
+
+// Converts digits with decimal and thousands separators into the form expected by strconv.ParseFloat
+func normalizeNumber(s string, format NumberFormat) (string, error) {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9') && r != '.' && r != ',' {
+			return "", errInvalidNumber
+		}
+	}
+
+	decimal, err := decimalSeparator(s, format)
+	if err != nil {
+		return "", err
+	}
+
+	integer, fraction, hasFraction := s, "", false
+	if decimal != "" {
+		i := strings.LastIndex(s, decimal)
+		integer, fraction, hasFraction = s[:i], s[i+1:], true
+	}
+
+	if hasFraction && (fraction == "" || strings.ContainsAny(fraction, ".,")) {
+		return "", errInvalidNumber
+	}
+
+	// Separators left in the integer part have to group thousands
+	if strings.ContainsAny(integer, ".,") {
+		thousands := "."
+		if decimal == "." || (decimal == "" && strings.Contains(integer, ",")) {
+			thousands = ","
+		}
+
+		groups := strings.Split(integer, thousands)
+		for i, g := range groups {
+			if g == "" || len(g) > 3 || (i > 0 && len(g) != 3) || strings.ContainsAny(g, ".,") {
+				return "", errInvalidNumber
+			}
+		}
+		integer = strings.Join(groups, "")
+	}
+
+	if integer == "" {
+		integer = "0"
+	}
+	if hasFraction {
+		return integer + "." + fraction, nil
+	}
+	return integer, nil
+}
+
+// Returns the decimal separator of s, "" if s only contains thousands separators or none at all
+func decimalSeparator(s string, format NumberFormat) (string, error) {
+	dots := strings.Count(s, ".")
+	commas := strings.Count(s, ",")
+
+	switch {
+	case dots == 0 && commas == 0:
+		return "", nil
+
+	case dots > 0 && commas > 0:
+		// The last separator is the decimal separator, e.g. "1.299,00" or "1,299.00"
+		decimal := ","
+		if strings.LastIndex(s, ".") > strings.LastIndex(s, ",") {
+			decimal = "."
+		}
+		if (format == NumberFormatGerman && decimal != ",") || (format == NumberFormatEnglish && decimal != ".") {
+			return "", errInvalidNumber
+		}
+		return decimal, nil
+
+	case commas > 0:
+		if commas > 1 {
+			if format == NumberFormatGerman {
+				return "", errInvalidNumber
+			}
+			return "", nil
+		}
+		if format == NumberFormatEnglish && digitsAfter(s, ",") == 3 {
+			return "", nil
+		}
+		return ",", nil
+
+	default:
+		if dots > 1 {
+			if format == NumberFormatEnglish {
+				return "", errInvalidNumber
+			}
+			return "", nil
+		}
+		if format == NumberFormatGerman && digitsAfter(s, ".") == 3 {
+			return "", nil
+		}
+		return ".", nil
+	}
+}
+
+func digitsAfter(s string, sep string) int {
+	return len(s) - strings.LastIndex(s, sep) - 1
+}
@@ -0,0 +1,379 @@
+package dataimport
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		format   NumberFormat
+		unit     numberUnit
+		expected float64
+		invalid  bool
+	}{
+		// Plain numbers
+		{input: "0", expected: 0},
+		{input: "42", expected: 42},
+		{input: "29.99", expected: 29.99},
+		{input: "29,99", expected: 29.99},
+		{input: ",5", expected: 0.5},
+		{input: "  7  ", expected: 7},
+
+		// Raw cell values written by excelize
+		{input: "1299", expected: 1299},
+		{input: "0.1", expected: 0.1},
+		{input: "1.5E-05", expected: 0.000015},
+		{input: "1.2345E+15", expected: 1.2345e15},
+		{input: "29.990000000000002", expected: 29.990000000000002},
+		{input: "29.99", format: NumberFormatGerman, expected: 29.99},
+		{input: "1.5E-05", format: NumberFormatGerman, expected: 0.000015},
+
+		// German format
+		{input: "1.299,00", expected: 1299},
+		{input: "1.299,00", format: NumberFormatGerman, expected: 1299},
+		{input: "1.299", format: NumberFormatGerman, expected: 1299},
+		{input: "1.299.000", expected: 1299000},
+		{input: "1.299.000,5", format: NumberFormatGerman, expected: 1299000.5},
+		{input: "1,299", format: NumberFormatGerman, expected: 1.299},
+		{input: "1.299.000", format: NumberFormatGerman, expected: 1299000},
+		{input: "1,299.00", format: NumberFormatGerman, invalid: true},
+		{input: "1,299,000", format: NumberFormatGerman, invalid: true},
+
+		// English format
+		{input: "1,299.00", expected: 1299},
+		{input: "1,299.00", format: NumberFormatEnglish, expected: 1299},
+		{input: "1,299", format: NumberFormatEnglish, expected: 1299},
+		{input: "1,299,000", expected: 1299000},
+		{input: "1,299", expected: 1.299},
+		{input: "29,99", format: NumberFormatEnglish, expected: 29.99},
+		{input: "1.299", format: NumberFormatEnglish, expected: 1.299},
+		{input: "1.299,00", format: NumberFormatEnglish, invalid: true},
+		{input: "1.299.000", format: NumberFormatEnglish, invalid: true},
+
+		// Currencies, units and percentages of the field's unit
+		{input: "€ 29,99", unit: unitEuro, expected: 29.99},
+		{input: "29,99 €", unit: unitEuro, expected: 29.99},
+		{input: "29,99€", unit: unitEuro, expected: 29.99},
+		{input: "29.99 EUR", unit: unitEuro, expected: 29.99},
+		{input: "29.99 eur", unit: unitEuro, expected: 29.99},
+		{input: "EUR 1.299,00", unit: unitEuro, expected: 1299},
+		{input: "29,99 Euro", unit: unitEuro, expected: 29.99},
+		{input: "19 %", unit: unitPercent, expected: 19},
+		{input: "19,5%", unit: unitPercent, expected: 19.5},
+		{input: "20 GB", unit: unitGigabyte, expected: 20},
+		{input: "500MB", unit: unitGigabyte, expected: 500.0 / 1024},
+		{input: "1,5 TB", unit: unitGigabyte, expected: 1536},
+		{input: "29,99", unit: unitEuro, expected: 29.99},
+		{input: "20", unit: unitGigabyte, expected: 20},
+
+		// Currencies and units not fitting the field
+		{input: "29,99 €", invalid: true},
+		{input: "20 GB", unit: unitEuro, invalid: true},
+		{input: "19 %", unit: unitEuro, invalid: true},
+		{input: "500MB", unit: unitNone, invalid: true},
+		{input: "29,99 €", unit: unitGigabyte, invalid: true},
+		{input: "$1,299.99", unit: unitEuro, invalid: true},
+		{input: "1.299,00 CHF", unit: unitEuro, invalid: true},
+		{input: "29.99 USD", unit: unitEuro, invalid: true},
+		{input: "€ 29,99 €", unit: unitEuro, invalid: true},
+
+		// Whitespace
+		{input: "1 299,00", expected: 1299},
+		{input: "29,99 €", unit: unitEuro, expected: 29.99},
+		{input: "1 299,00 €", unit: unitEuro, expected: 1299},
+		{input: "1 299 000", expected: 1299000},
+		{input: "1'299.00", expected: 1299},
+		{input: "\t29,99\n", expected: 29.99},
+
+		// Signs
+		{input: "-5", expected: -5},
+		{input: "+5", expected: 5},
+		{input: "-1.299,00 €", unit: unitEuro, expected: -1299},
+		{input: "€ -29,99", unit: unitEuro, expected: -29.99},
+		{input: "-€29.99", unit: unitEuro, expected: -29.99},
+		{input: "29,99-", expected: -29.99},
+
+		// Invalid values
+		{input: "", invalid: true},
+		{input: "   ", invalid: true},
+		{input: "n/a", invalid: true},
+		{input: "-", invalid: true},
+		{input: "€", unit: unitEuro, invalid: true},
+		{input: "abc", invalid: true},
+		{input: "12abc", invalid: true},
+		{input: "29,99 € (ab dem 13. Monat 39,99 €)", unit: unitEuro, invalid: true},
+		{input: "1.2.3", invalid: true},
+		{input: "1.29.000", invalid: true},
+		{input: "1234.567,00", invalid: true},
+		{input: "1,2,3.4", invalid: true},
+		{input: "29,", invalid: true},
+		{input: "29.", invalid: true},
+		{input: "1,299.00,00", invalid: true},
+		{input: "--5", invalid: true},
+		{input: "5-5", invalid: true},
+		{input: "1e5e5", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q/%s", tt.input, tt.format), func(t *testing.T) {
+			val, err := parseNumber(tt.input, tt.format, tt.unit)
+			if tt.invalid {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.expected, val, 1e-9)
+			}
+		})
+	}
+}
+
+func TestParseInteger(t *testing.T) {
+	tests := []struct {
+		input    string
+		format   NumberFormat
+		expected int
+		invalid  bool
+	}{
+		{input: "12", expected: 12},
+		{input: "12.0", expected: 12},
+		{input: "12,00", expected: 12},
+		{input: "1.200", format: NumberFormatGerman, expected: 1200},
+		{input: "1,200", format: NumberFormatEnglish, expected: 1200},
+		{input: "1.200.000", expected: 1200000},
+		{input: "-3", expected: -3},
+		{input: "1E+03", expected: 1000},
+		{input: "12,5", invalid: true},
+		{input: "3.5", invalid: true},
+		{input: "1E+20", invalid: true},
+		{input: "x", invalid: true},
+		{input: "", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q/%s", tt.input, tt.format), func(t *testing.T) {
+			val, err := parseInteger(tt.input, tt.format, unitNone)
+			if tt.invalid {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, val)
+			}
+		})
+	}
+}
+
+func TestNumberFormatValid(t *testing.T) {
+	assert.True(t, NumberFormatAuto.valid())
+	assert.True(t, NumberFormatGerman.valid())
+	assert.True(t, NumberFormatEnglish.valid())
+	assert.False(t, NumberFormat("fr").valid())
+}
+
+func TestWriteMappingNumberFormat(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr", "Anschlussgebühr"},
+		{"T-1", "1.299", "€ 39,99"},
+	})
+
+	tests := map[NumberFormat]float64{
+		NumberFormatAuto:    1.299,
+		NumberFormatGerman:  1299,
+		NumberFormatEnglish: 1.299,
+	}
+
+	for format, expected := range tests {
+		var updated *tariff.TariffCRUD
+		svc := &mappingService{
+			tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+				list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+					return []*tariff.TariffLookup{{Id: "T-1"}}, nil
+				},
+				read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					return &tariff.TariffCRUD{Id: s}, nil
+				},
+				update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					updated = tc
+					return tc, nil
+				},
+			},
+		}
+
+		options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		result, err := svc.WriteMapping(&MappingInstruction{
+			Uuid: options.Uuid,
+			Mapping: []MappingObject{
+				{ColIndex: 1, MappingValue: "ebootisId"},
+				{ColIndex: 2, MappingValue: "basicCharge"},
+				{ColIndex: 3, MappingValue: "connectionFee"},
+			},
+			UploadType:   "tariff",
+			NumberFormat: format,
+		})
+		if assert.NoError(t, err) && assert.Equal(t, 1, result.SuccessfulRows, format) {
+			assert.Equal(t, expected, updated.BasicCharge, format)
+			assert.Equal(t, 39.99, updated.ConnectionFee, format)
+		}
+	}
+
+	svc := &mappingService{}
+	_, err := svc.WriteMapping(&MappingInstruction{
+		Uuid:         "5b0e7f8a-2c43-4d2e-9a61-0f7d9c3b1e22",
+		Mapping:      []MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}},
+		UploadType:   "tariff",
+		NumberFormat: "fr",
+	})
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeNumberFormatUnknown, importErr.Code)
+	}
+}
+
+func TestWriteMappingNumberUnits(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr", "Datenvolumen"},
+		{"T-1", "29,99 €", "500MB"},
+		{"T-2", "20 GB", "10 GB"},
+		{"T-3", "29,99 USD", "10"},
+	})
+
+	updated := make(map[string]*tariff.TariffCRUD)
+	svc := &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				updated[s] = tc
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+			{ColIndex: 3, MappingValue: "dataVolume"},
+		},
+		UploadType: "tariff",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 1, result.SuccessfulRows)
+	if assert.Contains(t, updated, "T-1") {
+		assert.Equal(t, 29.99, updated["T-1"].BasicCharge)
+		assert.Equal(t, 500.0/1024, updated["T-1"].DataVolume, "MB are converted into GB")
+	}
+
+	// Units not fitting the field and other currencies are rejected instead of being dropped
+	if assert.Len(t, result.FailedRows, 2) {
+		for i, row := range []int{3, 4} {
+			assert.Equal(t, ErrCodeCellParseFailed, result.FailedRows[i].Code)
+			assert.Equal(t, row, result.FailedRows[i].Row)
+			assert.Equal(t, "basicCharge", result.FailedRows[i].Field)
+		}
+	}
+}
+
+func TestWriteMappingNumberCells(t *testing.T) {
+	sheet := excelize.NewFile()
+	defer sheet.Close()
+
+	thousands, _ := sheet.NewStyle(&excelize.Style{NumFmt: 3})      // #,##0
+	thousandsCents, _ := sheet.NewStyle(&excelize.Style{NumFmt: 4}) // #,##0.00
+	sheet.SetSheetRow("Sheet1", "A1", &[]string{"EbootisId", "Grundgebühr"})
+	for i, cell := range []struct {
+		id    string
+		value any
+		style int
+	}{
+		{"T-1", 1299.5, thousandsCents},
+		{"T-2", 1299, thousands},
+		{"T-3", 0.125, 0},
+		{"T-4", "1.299", 0},
+		{"T-5", "29,99", 0},
+	} {
+		row := i + 2
+		sheet.SetCellStr("Sheet1", cellRef(1, row), cell.id)
+		sheet.SetCellValue("Sheet1", cellRef(2, row), cell.value)
+		if cell.style != 0 {
+			sheet.SetCellStyle("Sheet1", cellRef(2, row), cellRef(2, row), cell.style)
+		}
+	}
+	buf, err := sheet.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("Creating test .xlsx failed: %v", err)
+	}
+
+	// Number cells are read the same whatever the number format of the upload, which only applies to text cells
+	for format, textThousands := range map[NumberFormat]float64{NumberFormatGerman: 1299, NumberFormatAuto: 1.299} {
+		t.Run(string(format), func(t *testing.T) {
+			updated := make(map[string]float64)
+			svc := &mappingService{
+				tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+					list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+						return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+					},
+					read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+						return &tariff.TariffCRUD{Id: s}, nil
+					},
+					update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+						updated[s] = tc.BasicCharge
+						return tc, nil
+					},
+				},
+			}
+
+			options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(buf.Bytes()), UploadType: "tariff"})
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			result, err := svc.WriteMapping(&MappingInstruction{
+				Uuid: options.Uuid,
+				Mapping: []MappingObject{
+					{ColIndex: 1, MappingValue: "ebootisId"},
+					{ColIndex: 2, MappingValue: "basicCharge"},
+				},
+				UploadType:   "tariff",
+				NumberFormat: format,
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Empty(t, result.FailedRows)
+			assert.Equal(t, map[string]float64{
+				"T-1": 1299.5,
+				"T-2": 1299,
+				"T-3": 0.125,
+				"T-4": textThousands,
+				"T-5": 29.99,
+			}, updated)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package dataimport
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// Row of an upload on its way through the rowPool, carrying what was read from the upload and the outcome of
+// its lookups and updates
+type rowJob struct {
+	seq             int
+	row             int
+	identifierValue string
+	values          []cellValue
+
+	readErr  *Error  // identifier cell couldn't be read, nothing to process
+	cellErrs []Error // invalid cells rejecting the row, nothing to process
+	skipped  []Error // invalid cells left out, see MappingInstruction.SkipInvalidFields
+
+	// Outcome of processing
+	err      *Error
+	changes  []EntityChange
+	journal  importJournal
+	hardware []*editedCRUDobj // looked up, edited in row order when applied
+	aborted  bool             // not processed as the import was aborted before
+}
+
+func (job *rowJob) ready() bool {
+	return job.readErr != nil || len(job.cellErrs) > 0
+}
+
+// Processes rows with a bounded number of workers, while their outcomes are applied one after another in
+// order of submission. Rows with the same key are processed by the same worker in order of submission, so
+// rows writing the same entity don't overtake each other. At most inFlightPerWorker rows per worker are submitted
+// and not applied yet, so a slow row holds back the rows after it instead of letting them pile up. With at most
+// one worker rows are processed right away in the submitting goroutine.
+type rowPool struct {
+	process func(*rowJob)
+	apply   func(*rowJob)
+	seq     int
+
+	workers  []chan *rowJob
+	results  chan *rowJob
+	inFlight chan struct{} // one slot per row submitted and not applied yet
+	wg       sync.WaitGroup
+	done     chan struct{}
+}
+
+// Rows per worker submitted and not applied yet
+const inFlightPerWorker = 4
+
+func newRowPool(workers int, process func(*rowJob), apply func(*rowJob)) *rowPool {
+	pool := &rowPool{process: process, apply: apply}
+	if workers <= 1 {
+		return pool
+	}
+
+	pool.results = make(chan *rowJob, workers)
+	pool.inFlight = make(chan struct{}, inFlightPerWorker*workers)
+	pool.done = make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		jobs := make(chan *rowJob, 1)
+		pool.workers = append(pool.workers, jobs)
+
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range jobs {
+				process(job)
+				pool.results <- job
+			}
+		}()
+	}
+
+	go pool.collect()
+	return pool
+}
+
+func (pool *rowPool) submit(job *rowJob, key string) {
+	job.seq = pool.seq
+	pool.seq++
+
+	if len(pool.workers) == 0 {
+		if !job.ready() {
+			pool.process(job)
+		}
+		pool.apply(job)
+		return
+	}
+
+	pool.inFlight <- struct{}{}
+	if job.ready() {
+		pool.results <- job
+		return
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	pool.workers[hash.Sum32()%uint32(len(pool.workers))] <- job
+}
+
+// Applies the processed rows in order of submission
+func (pool *rowPool) collect() {
+	defer close(pool.done)
+
+	pending := make(map[int]*rowJob)
+	next := 0
+	for job := range pool.results {
+		pending[job.seq] = job
+		for ready, ok := pending[next]; ok; ready, ok = pending[next] {
+			delete(pending, next)
+			pool.apply(ready)
+			<-pool.inFlight
+			next++
+		}
+	}
+}
+
+// Waits until all submitted rows are processed and applied
+func (pool *rowPool) wait() {
+	if len(pool.workers) == 0 {
+		return
+	}
+
+	for _, jobs := range pool.workers {
+		close(jobs)
+	}
+	pool.wg.Wait()
+	close(pool.results)
+	<-pool.done
+}
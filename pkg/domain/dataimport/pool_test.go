@@ -0,0 +1,197 @@
+package dataimport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowPoolOrder(t *testing.T) {
+	for _, workers := range []int{0, 1, 4} {
+		var applied []int
+		pool := newRowPool(workers, func(job *rowJob) {}, func(job *rowJob) {
+			applied = append(applied, job.row)
+		})
+
+		expected := make([]int, 0, 100)
+		for row := 1; row <= 100; row++ {
+			job := &rowJob{row: row}
+			if row%7 == 0 {
+				job.readErr = &Error{Code: ErrCodeCellReadFailed}
+			}
+			pool.submit(job, fmt.Sprint(row%5))
+			expected = append(expected, row)
+		}
+		pool.wait()
+
+		assert.Equal(t, expected, applied, "workers: %d", workers)
+	}
+}
+
+func TestRowPoolSlowHeadRow(t *testing.T) {
+	const workers, rows = 4, 10000
+
+	release := make(chan struct{})
+	var submitted, applied atomic.Int64
+	maxInFlight := int64(0)
+	pool := newRowPool(workers, func(job *rowJob) {
+		if job.row == 1 {
+			<-release
+		}
+	}, func(job *rowJob) {
+		maxInFlight = max(maxInFlight, submitted.Load()-applied.Load())
+		applied.Add(1)
+	})
+
+	go func() {
+		// Rows after the slow one are held back instead of piling up until it's done
+		time.Sleep(50 * time.Millisecond)
+		assert.LessOrEqual(t, submitted.Load(), int64(inFlightPerWorker*workers))
+		close(release)
+	}()
+	for row := 1; row <= rows; row++ {
+		job := &rowJob{row: row}
+		if row > 1 {
+			// Rejected rows pass by the workers, only the limit holds them back
+			job.cellErrs = []Error{{Code: ErrCodeCellParseFailed}}
+		}
+		pool.submit(job, fmt.Sprint(row))
+		submitted.Add(1)
+	}
+	pool.wait()
+
+	assert.Equal(t, int64(rows), applied.Load())
+	assert.LessOrEqual(t, maxInFlight, int64(inFlightPerWorker*workers))
+}
+
+func TestWriteMappingWorkers(t *testing.T) {
+	rows := [][]string{{"EbootisId", "Grundgebühr"}}
+	for i := 1; i <= 60; i++ {
+		rows = append(rows, []string{fmt.Sprintf("T-%d", i%20), fmt.Sprint(i)})
+	}
+	upload := newTestWorkbook(t, rows)
+
+	var mu sync.Mutex
+	stored := make(map[string]float64)
+	svc := &mappingService{
+		workers: 8,
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				id := o[0].Value.(string)
+				if id == "T-13" {
+					return nil, errors.New("lookup failed")
+				}
+				return []*tariff.TariffLookup{{Id: id}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return &tariff.TariffCRUD{Id: s, BasicCharge: stored[s]}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				stored[s] = tc.BasicCharge
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+		},
+		UploadType: "tariff",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 57, result.SuccessfulRows)
+	assert.Equal(t, 3, result.UnsuccessfulRows)
+	if assert.Len(t, result.FailedRows, 3) {
+		for i, row := range []int{14, 34, 54} {
+			assert.Equal(t, row, result.FailedRows[i].Row, "failed rows are reported in row order")
+		}
+	}
+	assert.Equal(t, 41.0, stored["T-1"], "rows of the same tariff are written in row order")
+	assert.Equal(t, 60.0, stored["T-0"])
+}
+
+func TestWriteMappingWorkersHardware(t *testing.T) {
+	rows := [][]string{{"EbootisId", "Bestand"}}
+	variants := make([]*hardware.VariantCRUD, 0, 40)
+	for i := 1; i <= 40; i++ {
+		id := fmt.Sprintf("1000-%d", i)
+		rows = append(rows, []string{id, fmt.Sprint(i)})
+		variants = append(variants, &hardware.VariantCRUD{EbootisId: id})
+	}
+	upload := newTestWorkbook(t, rows)
+
+	var mu sync.Mutex
+	reads, updates := 0, 0
+	var written *hardware.HardwareCRUD
+	svc := &mappingService{
+		workers: 8,
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				reads++
+				return &hardware.HardwareCRUD{Id: s, Variants: variants}, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				updates++
+				written = h
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "stocks"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 40, result.SuccessfulRows)
+	assert.Equal(t, 1, reads, "hardware is read once per import")
+	assert.Equal(t, 1, updates, "hardware is written once per import")
+	if assert.NotNil(t, written) {
+		for i, variant := range written.Variants {
+			assert.Equal(t, intPtr(i+1), variant.Stock)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package dataimport
+
+import (
+	"fmt"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/product"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+)
+
+// Every mappable field is declared once per upload type in the registries below.
+// DROPDOWN_OPTIONS and the write logic of WriteMapping are both derived from them.
+
+var tariffFields = fieldRegistry[tariffTarget]{
+	identifierField[tariffTarget]("ebootisId", "EbootisId").withAliases("Ebootis", "Tarif-ID"),
+	floatField("basicCharge", "Preis monatlich", func(t tariffTarget, v float64) {
+		t.BasicCharge = v
+		if len(t.PricingIntervals) > 0 {
+			t.PricingIntervals[0].Price = v
+		}
+	}).withUnit(unitEuro).withBullet("tariff_monthly_price", " €").withAliases("Grundgebühr", "Monatspreis"), // TODO: writebullet für tariff_monthly_price > problem, da in tariff_monthly_price auch strings wie "34.99€ (ab dem 13. Monat 69.99€)" stehen
+	floatField("basicChargeRenewal", "Preis monatlich nach Aktionszeitraum", func(t tariffTarget, v float64) {
+		t.BasicChargeRenewal = v
+		if len(t.PricingIntervals) > 1 {
+			t.PricingIntervals[1].Price = v
+		}
+	}).withUnit(unitEuro).withAliases("Grundgebühr nach Aktion", "Preis ab Monat 13"),
+	intField("leadType", "Lead Type", func(t tariffTarget, v int) { t.LeadType = v }),
+	floatField("provision", "Marktprämie", func(t tariffTarget, v float64) { t.Provision = v }).withUnit(unitEuro),
+	floatField("xProvision", "Onlineprämie", func(t tariffTarget, v float64) { t.XProvision = v }).withUnit(unitEuro),
+	floatField("connectionFee", "Anschlussgebühr (ohne EUR-Zeichen)", func(t tariffTarget, v float64) {
+		t.ConnectionFee = v
+	}).withUnit(unitEuro).withBullet("tariff_connection_fee", " €").withAliases("Anschlusspreis", "Bereitstellungsgebühr"), // ! Produktmanagement über Funktionsweise unterrichten
+	floatField("dataVolume", "Inkl. Datenvolumen in GB", func(t tariffTarget, v float64) { t.DataVolume = v }).withUnit(unitGigabyte).withAliases("Datenvolumen", "Volumen GB"),
+	stringField("legalNote", "Legalnote", func(t tariffTarget, v string) { t.LegalNote = v }).withAliases("Rechtstext", "Fußnote"),
+	stringField("pibLink", "Pib-URL", func(t tariffTarget, v string) { t.PibLink = v }).withAliases("Produktinformationsblatt", "PIB"),
+	highlightField(1),
+	highlightField(2),
+	highlightField(3),
+	highlightField(4),
+	highlightField(5),
+	bulletField[tariffTarget]("bullet1", "Inklusiv-Benefit 1", "tariff_inclusive_benefit1"),
+	bulletField[tariffTarget]("bullet2", "Inklusiv-Benefit 2", "tariff_inclusive_benefit2"),
+	bulletField[tariffTarget]("bullet3", "Inklusiv-Benefit 3", "tariff_inclusive_benefit3"),
+	bulletField[tariffTarget]("bullet4", "Inklusiv-Benefit 4", "tariff_inclusive_benefit4"),
+	bulletField[tariffTarget]("bullet5", "Inklusiv-Benefit 5", "tariff_inclusive_benefit5"),
+	bulletField[tariffTarget]("bullet6", "Inklusiv-Benefit 6", "tariff_inclusive_benefit6"),
+	wkzField[tariffTarget]("supplierWkz", "Supplier WKZ", "supplier"),
+	wkzField[tariffTarget]("tariffWkz", "Tariff WKZ", "tariff"),
+}
+
+var hardwareFields = fieldRegistry[hardwareTarget]{
+	identifierField[hardwareTarget]("ebootisId", "EbootisId").withAliases("Ebootis"),
+	identifierField[hardwareTarget]("externalArticleNumber", "Exerterne Artikelnr.").withAliases("ArtNr", "Artikelnummer", "Externe Artikelnummer"),
+	floatField("price", "EK", func(t hardwareTarget, v float64) { t.variant.Price = v }).withUnit(unitEuro).forVariant().withAliases("EK Preis", "Einkaufspreis"),
+	wkzField[hardwareTarget]("manufactWkz", "Manufacturer WKZ", "manufacturer").withAliases("Hersteller WKZ"),
+	wkzField[hardwareTarget]("ek24Wkz", "ek24 WKZ", "ek24"),
+}
+
+var stockFields = fieldRegistry[hardwareTarget]{
+	identifierField[hardwareTarget]("ebootisId", "EbootisId").withAliases("Ebootis"),
+	identifierField[hardwareTarget]("externalArticleNumber", "Exerterne Artikelnr.").withAliases("ArtNr", "Artikelnummer", "Externe Artikelnummer"),
+	intField("currentStock", "Stock aktuell", func(t hardwareTarget, v int) { t.variant.Stock = &v }).forVariant().withAliases("Bestand", "Lagerbestand"),
+	intField("originalStock", "Stock original", func(t hardwareTarget, v int) { t.variant.OriginalStock = &v }).forVariant().withAliases("Bestand original", "Anfangsbestand"),
+}
+
+// Non-generic view on the field registries, keyed by upload type
+var uploadTypeFields = map[string]fieldSet{
+	"tariff":   tariffFields,
+	"hardware": hardwareFields,
+	"stocks":   stockFields,
+}
+
+var DROPDOWN_OPTIONS = dropdownOptions()
+
+func dropdownOptions() map[string]map[string]string {
+	result := make(map[string]map[string]string, len(uploadTypeFields))
+	for uploadType, fields := range uploadTypeFields {
+		result[uploadType] = fields.dropdownOptions()
+	}
+	return result
+}
+
+type fieldSet interface {
+	dropdownOptions() map[string]string
+	hasField(key string) bool
+	// Reports if the field has any effect when mapped (setter, side effect or row identification)
+	handles(key string) bool
+	// Reports if the field identifies the row
+	identifies(key string) bool
+	// Reports if the cells of the field are parsed as numbers
+	numeric(key string) bool
+	// Parses the cell value for the field, see fieldDef.parse
+	parse(key string, cellVal string, format NumberFormat) (any, error)
+	// Handling of empty cells of the field if the mapping doesn't specify one
+	emptyCells(key string) EmptyCellPolicy
+	suggest(headers []string, samples [][]string) []Suggestion
+}
+
+// Entities the mapped fields are written to. Bullets and WKZ are written through the option accessors.
+type optionTarget interface {
+	bulletOptions() *[]*product.Option
+	wkzOptions() *[]*product.Option
+}
+
+type tariffTarget struct {
+	*tariff.TariffCRUD
+}
+
+func (t tariffTarget) bulletOptions() *[]*product.Option {
+	return &t.Bullets
+}
+
+func (t tariffTarget) wkzOptions() *[]*product.Option {
+	return &t.Wkz
+}
+
+// Hardware of a row together with the variant identified by the row.
+// variant is only resolved if a variant field is mapped.
+type hardwareTarget struct {
+	*hardware.HardwareCRUD
+	variant *hardware.VariantCRUD
+}
+
+func (t hardwareTarget) bulletOptions() *[]*product.Option {
+	return &t.Bullets
+}
+
+func (t hardwareTarget) wkzOptions() *[]*product.Option {
+	return &t.Wkz
+}
+
+type valueKind int
+
+const (
+	stringValue valueKind = iota
+	floatValue
+	intValue
+)
+
+// Parses the cell value into the Go type of the kind. Numbers are parsed according to format and converted into unit.
+func (kind valueKind) parse(cellVal string, format NumberFormat, unit numberUnit) (any, error) {
+	switch kind {
+	case floatValue:
+		return parseNumber(cellVal, format, unit)
+	case intValue:
+		return parseInteger(cellVal, format, unit)
+	default:
+		return cellVal, nil
+	}
+}
+
+func (kind valueKind) zero() any {
+	switch kind {
+	case floatValue:
+		return 0.0
+	case intValue:
+		return 0
+	default:
+		return ""
+	}
+}
+
+type fieldDef[T optionTarget] struct {
+	key   string
+	label string
+	kind  valueKind
+	// Unit of numeric fields, deciding which currency symbols and units their cells may contain
+	unit numberUnit
+	// Writes the parsed value. Nil for fields which only identify the row or only have side effects.
+	set func(obj T, val any)
+	// Bullet written with the cell value (+ bulletSuffix) alongside the field. Currency symbols and units are
+	// stripped from the cells of numeric fields, the suffix adds them back in a uniform way.
+	bullet       string
+	bulletSuffix string
+	// WKZ written with the cell value
+	wkz        string
+	identifier bool
+	// Field is written to the variant identified by the row
+	variant bool
+	// Alternative header names used for suggestions
+	aliases []string
+}
+
+func (f *fieldDef[T]) withBullet(key string, suffix string) *fieldDef[T] {
+	f.bullet = key
+	f.bulletSuffix = suffix
+	return f
+}
+
+func (f *fieldDef[T]) withUnit(unit numberUnit) *fieldDef[T] {
+	f.unit = unit
+	return f
+}
+
+func (f *fieldDef[T]) withAliases(aliases ...string) *fieldDef[T] {
+	f.aliases = aliases
+	return f
+}
+
+func (f *fieldDef[T]) forVariant() *fieldDef[T] {
+	f.variant = true
+	return f
+}
+
+// Parses the cell value into the type of the field
+func (f *fieldDef[T]) parse(cellVal string, format NumberFormat) (any, error) {
+	if f.set == nil {
+		return cellVal, nil
+	}
+	return f.kind.parse(cellVal, format, f.unit)
+}
+
+// Empty cells of numeric fields leave the current value untouched instead of resetting it to 0
+func (f *fieldDef[T]) emptyCells() EmptyCellPolicy {
+	if f.set != nil && (f.kind == floatValue || f.kind == intValue) {
+		return EmptyCellsKeep
+	}
+	return EmptyCellsClear
+}
+
+// Resets the field to the zero value of its kind and removes its bullet and WKZ
+func (f *fieldDef[T]) clear(obj T) {
+	if f.set != nil {
+		f.set(obj, f.kind.zero())
+	}
+
+	if f.bullet != "" {
+		bullets := obj.bulletOptions()
+		*bullets = removeOption(*bullets, f.bullet)
+	}
+
+	if f.wkz != "" {
+		wkz := obj.wkzOptions()
+		*wkz = removeOption(*wkz, f.wkz)
+	}
+}
+
+// Writes the parsed cell value into obj, including bullet and WKZ side effects
+func (f *fieldDef[T]) write(obj T, cellVal string, val any) {
+	if f.set != nil {
+		f.set(obj, val)
+	}
+
+	if f.bullet != "" {
+		text := cellVal
+		if f.kind != stringValue {
+			text = stripNumberUnit(cellVal)
+		}
+		bullets := obj.bulletOptions()
+		*bullets = writeOptionArr(*bullets, f.bullet, text+f.bulletSuffix)
+	}
+
+	if f.wkz != "" {
+		wkz := obj.wkzOptions()
+		*wkz = writeOptionArr(*wkz, f.wkz, cellVal)
+	}
+}
+
+func identifierField[T optionTarget](key string, label string) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, identifier: true}
+}
+
+func stringField[T optionTarget](key string, label string, set func(T, string)) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, kind: stringValue, set: func(obj T, val any) { set(obj, val.(string)) }}
+}
+
+func floatField[T optionTarget](key string, label string, set func(T, float64)) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, kind: floatValue, set: func(obj T, val any) { set(obj, val.(float64)) }}
+}
+
+func intField[T optionTarget](key string, label string, set func(T, int)) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, kind: intValue, set: func(obj T, val any) { set(obj, val.(int)) }}
+}
+
+func bulletField[T optionTarget](key string, label string, bullet string) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, bullet: bullet}
+}
+
+func wkzField[T optionTarget](key string, label string, wkz string) *fieldDef[T] {
+	return &fieldDef[T]{key: key, label: label, wkz: wkz}
+}
+
+func highlightField(n int) *fieldDef[tariffTarget] {
+	return stringField(fmt.Sprintf("highlight%d", n), fmt.Sprintf("Highlight %d", n), func(t tariffTarget, v string) {
+		for len(t.Highlights) < n {
+			t.Highlights = append(t.Highlights, "")
+		}
+		t.Highlights[n-1] = v
+	})
+}
+
+type fieldRegistry[T optionTarget] []*fieldDef[T]
+
+func (r fieldRegistry[T]) field(key string) (*fieldDef[T], bool) {
+	for _, f := range r {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (r fieldRegistry[T]) hasField(key string) bool {
+	_, ok := r.field(key)
+	return ok
+}
+
+func (r fieldRegistry[T]) handles(key string) bool {
+	f, ok := r.field(key)
+	return ok && (f.identifier || f.set != nil || f.bullet != "" || f.wkz != "")
+}
+
+func (r fieldRegistry[T]) identifies(key string) bool {
+	f, ok := r.field(key)
+	return ok && f.identifier
+}
+
+func (r fieldRegistry[T]) numeric(key string) bool {
+	f, ok := r.field(key)
+	return ok && f.set != nil && (f.kind == floatValue || f.kind == intValue)
+}
+
+func (r fieldRegistry[T]) parse(key string, cellVal string, format NumberFormat) (any, error) {
+	f, ok := r.field(key)
+	if !ok {
+		return cellVal, nil
+	}
+	return f.parse(cellVal, format)
+}
+
+func (r fieldRegistry[T]) emptyCells(key string) EmptyCellPolicy {
+	f, ok := r.field(key)
+	if !ok {
+		return EmptyCellsKeep
+	}
+	return f.emptyCells()
+}
+
+// Writes the parsed cells of a row into obj
+func (r fieldRegistry[T]) write(obj T, values []cellValue) {
+	for _, v := range values {
+		f, ok := r.field(v.MappingValue)
+		if !ok {
+			continue
+		}
+		if v.clear {
+			f.clear(obj)
+			continue
+		}
+		f.write(obj, v.raw, v.val)
+	}
+}
+
+func (r fieldRegistry[T]) dropdownOptions() map[string]string {
+	result := make(map[string]string, len(r))
+	for _, f := range r {
+		result[f.key] = f.label
+	}
+	return result
+}
+
+// Reports if any of the mapped fields is written to the variant of the row
+func (r fieldRegistry[T]) mapsVariant(mapping []MappingObject) bool {
+	for _, m := range mapping {
+		if f, ok := r.field(m.MappingValue); ok && f.variant {
+			return true
+		}
+	}
+	return false
+}
+
+// Drops trailing empty entries, e.g. of highlights
+func trimTrailingEmpty(arr []string) []string {
+	for len(arr) > 0 && arr[len(arr)-1] == "" {
+		arr = arr[:len(arr)-1]
+	}
+	return arr
+}
@@ -0,0 +1,143 @@
+package dataimport
+
+import (
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/product"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropdownOptionsHaveHandlers(t *testing.T) {
+	for uploadType, options := range DROPDOWN_OPTIONS {
+		fields, ok := uploadTypeFields[uploadType]
+		if !assert.True(t, ok, "upload type %s has no field registry", uploadType) {
+			continue
+		}
+
+		assert.NotEmpty(t, options)
+		for key := range options {
+			assert.True(t, fields.handles(key), "dropdown key %s of upload type %s has no handler", key, uploadType)
+		}
+	}
+}
+
+func TestTariffFieldsApply(t *testing.T) {
+	tariffObj := &tariff.TariffCRUD{
+		Highlights:       []string{"alt"},
+		PricingIntervals: []*product.PricingInterval{{Price: 1}, {Price: 2}},
+		Bullets:          []*product.Option{{Key: "tariff_monthly_price", Value: "1 €"}},
+	}
+	target := tariffTarget{tariffObj}
+
+	values := map[string]string{
+		"basicCharge":        "29,99",
+		"basicChargeRenewal": "39.99",
+		"leadType":           "3",
+		"legalNote":          "Hinweis",
+		"highlight3":         "Neu",
+		"bullet2":            "Benefit",
+		"supplierWkz":        "10",
+	}
+	for key, val := range values {
+		field, ok := tariffFields.field(key)
+		if !assert.True(t, ok, key) {
+			continue
+		}
+		parsed, err := field.parse(val, NumberFormatAuto)
+		if assert.NoError(t, err, key) {
+			field.write(target, val, parsed)
+		}
+	}
+
+	assert.Equal(t, 29.99, tariffObj.BasicCharge)
+	assert.Equal(t, 29.99, tariffObj.PricingIntervals[0].Price)
+	assert.Equal(t, 39.99, tariffObj.PricingIntervals[1].Price)
+	assert.Equal(t, 3, tariffObj.LeadType)
+	assert.Equal(t, "Hinweis", tariffObj.LegalNote)
+	assert.Equal(t, []string{"alt", "", "Neu"}, tariffObj.Highlights)
+	assert.Equal(t, []*product.Option{
+		{Key: "tariff_monthly_price", Value: "29,99 €"},
+		{Key: "tariff_inclusive_benefit2", Value: "Benefit"},
+	}, tariffObj.Bullets)
+	assert.Equal(t, []*product.Option{{Key: "supplier", Value: "10"}}, tariffObj.Wkz)
+}
+
+func TestFieldWriteBulletOfAmount(t *testing.T) {
+	basicCharge, _ := tariffFields.field("basicCharge")
+
+	for cell, bullet := range map[string]string{
+		"29,99":     "29,99 €",
+		"29,99 €":   "29,99 €",
+		"EUR 29.99": "29.99 €",
+		"€29,99":    "29,99 €",
+	} {
+		tariffObj := &tariff.TariffCRUD{}
+		parsed, err := basicCharge.parse(cell, NumberFormatAuto)
+		if !assert.NoError(t, err, cell) {
+			continue
+		}
+		basicCharge.write(tariffTarget{tariffObj}, cell, parsed)
+
+		assert.Equal(t, []*product.Option{{Key: "tariff_monthly_price", Value: bullet}}, tariffObj.Bullets, cell)
+	}
+}
+
+func TestFieldParseStrict(t *testing.T) {
+	basicCharge, _ := tariffFields.field("basicCharge")
+	leadType, _ := tariffFields.field("leadType")
+	legalNote, _ := tariffFields.field("legalNote")
+
+	for _, val := range []string{"n/a", "29,99 € (ab dem 13. Monat 39,99 €)", "1.234.56"} {
+		_, err := basicCharge.parse(val, NumberFormatAuto)
+		assert.Error(t, err, val)
+	}
+
+	_, err := leadType.parse("3.5", NumberFormatAuto)
+	assert.Error(t, err)
+
+	val, err := legalNote.parse("Hinweis", NumberFormatAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hinweis", val)
+}
+
+func TestFieldEmptyCells(t *testing.T) {
+	defaults := map[string]EmptyCellPolicy{
+		"basicCharge": EmptyCellsKeep,
+		"leadType":    EmptyCellsKeep,
+		"legalNote":   EmptyCellsClear,
+		"bullet1":     EmptyCellsClear,
+		"supplierWkz": EmptyCellsClear,
+	}
+	for key, expected := range defaults {
+		assert.Equal(t, expected, tariffFields.emptyCells(key), key)
+	}
+
+	tariffObj := &tariff.TariffCRUD{
+		BasicCharge: 19.99,
+		LegalNote:   "Hinweis",
+		Bullets: []*product.Option{
+			{Key: "tariff_connection_fee", Value: "9,99 €"},
+			{Key: "tariff_inclusive_benefit1", Value: "Benefit"},
+		},
+		ConnectionFee: 9.99,
+		Wkz:           []*product.Option{{Key: "supplier", Value: "10"}},
+	}
+
+	tariffFields.write(tariffTarget{tariffObj}, []cellValue{
+		{MappingObject: MappingObject{MappingValue: "legalNote"}, clear: true},
+		{MappingObject: MappingObject{MappingValue: "connectionFee"}, clear: true},
+		{MappingObject: MappingObject{MappingValue: "supplierWkz"}, clear: true},
+	})
+
+	assert.Equal(t, 19.99, tariffObj.BasicCharge)
+	assert.Equal(t, "", tariffObj.LegalNote)
+	assert.Equal(t, 0.0, tariffObj.ConnectionFee)
+	assert.Equal(t, []*product.Option{{Key: "tariff_inclusive_benefit1", Value: "Benefit"}}, tariffObj.Bullets)
+	assert.Empty(t, tariffObj.Wkz)
+}
+
+func TestTrimTrailingEmpty(t *testing.T) {
+	assert.Equal(t, []string{"a", "", "b"}, trimTrailingEmpty([]string{"a", "", "b", "", ""}))
+	assert.Empty(t, trimTrailingEmpty([]string{"", ""}))
+}
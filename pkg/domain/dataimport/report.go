@@ -0,0 +1,223 @@
+package dataimport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xuri/excelize/v2"
+)
+
+// File name of the annotated copy of the upload
+const reportFileName = "errors.xlsx"
+
+const reportAuthor = "Import"
+
+// Outcome per imported row, used to annotate a copy of the uploaded file
+type importReport struct {
+	headerRow  int
+	idCol      int
+	text       reportText
+	rows       map[int][]Error // rows without errors were imported successfully
+	failedRows int
+}
+
+func newImportReport(headerRow int, idCol int, locale string) *importReport {
+	return &importReport{headerRow: headerRow, idCol: idCol, text: reportTexts[normalizeLocale(locale)], rows: make(map[int][]Error)}
+}
+
+func (r *importReport) success(row int) {
+	if _, ok := r.rows[row]; !ok {
+		r.rows[row] = nil
+	}
+}
+
+func (r *importReport) fail(row int, err Error) {
+	if len(r.rows[row]) == 0 {
+		r.failedRows++
+	}
+	r.rows[row] = append(r.rows[row], err)
+}
+
+// Writes a copy of the uploaded sheet with an additional status column. Failing cells are highlighted
+// and carry the error message as comment. Cells of errors without column are the identifier cells.
+func (r *importReport) write(file tableSource, sheet string) ([]byte, error) {
+	out, outSheet, err := reportWorkbook(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	statusCol, err := nextFreeColumn(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	headerCell, _ := excelize.CoordinatesToCellName(statusCol, r.headerRow)
+	if err := out.SetCellValue(outSheet, headerCell, r.text.header); err != nil {
+		return nil, err
+	}
+
+	highlights := make(map[int]int) // original style → highlighted style
+	rows := make([]int, 0, len(r.rows))
+	for row := range r.rows {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+
+	for _, row := range rows {
+		errs := r.rows[row]
+		statusCell, _ := excelize.CoordinatesToCellName(statusCol, row)
+
+		if len(errs) == 0 {
+			if err := out.SetCellValue(outSheet, statusCell, r.text.ok); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		msgs := make([]string, len(errs))
+		cellMsgs := make(map[int][]string)
+		for i, e := range errs {
+			msgs[i] = e.ErrMsg
+			col := e.Column
+			if col <= 0 {
+				col = r.idCol
+			}
+			cellMsgs[col] = append(cellMsgs[col], e.ErrMsg)
+		}
+
+		if err := out.SetCellValue(outSheet, statusCell, r.text.failed+": "+strings.Join(msgs, "; ")); err != nil {
+			return nil, err
+		}
+
+		for col, colMsgs := range cellMsgs {
+			cell, err := excelize.CoordinatesToCellName(col, row)
+			if err != nil {
+				continue
+			}
+			if err := highlightCell(out, outSheet, cell, highlights); err != nil {
+				return nil, err
+			}
+
+			out.DeleteComment(outSheet, cell)
+			if err := out.AddComment(outSheet, excelize.Comment{
+				Author:    reportAuthor,
+				Cell:      cell,
+				Paragraph: []excelize.RichTextRun{{Text: strings.Join(colMsgs, "\n")}},
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := out.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// Returns the uploaded workbook itself for xlsx uploads, a new workbook holding the rows for csv uploads
+func reportWorkbook(file tableSource, sheet string) (*excelize.File, string, error) {
+	if src, ok := file.(*xlsxSource); ok {
+		data, err := src.file.WriteToBuffer()
+		if err != nil {
+			return nil, "", err
+		}
+		out, err := excelize.OpenReader(data)
+		return out, sheet, err
+	}
+
+	out := excelize.NewFile()
+	if err := out.SetSheetName(out.GetSheetName(0), sheet); err != nil {
+		out.Close()
+		return nil, "", err
+	}
+
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		out.Close()
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	for row := 1; rows.Next(); row++ {
+		cols, err := rows.Columns()
+		if err != nil {
+			out.Close()
+			return nil, "", err
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err := out.SetSheetRow(sheet, cell, &cols); err != nil {
+			out.Close()
+			return nil, "", err
+		}
+	}
+	return out, sheet, nil
+}
+
+// Returns the first column right of all filled cells of the sheet
+func nextFreeColumn(file tableSource, sheet string) (int, error) {
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	width := 0
+	for rows.Next() {
+		cols, err := rows.Columns()
+		if err != nil {
+			return 0, err
+		}
+		width = max(width, len(cols))
+	}
+	return width + 1, nil
+}
+
+// Fills the cell red while keeping its other formatting, e.g. number formats
+func highlightCell(out *excelize.File, sheet string, cell string, highlights map[int]int) error {
+	styleId, err := out.GetCellStyle(sheet, cell)
+	if err != nil {
+		return err
+	}
+
+	highlighted, ok := highlights[styleId]
+	if !ok {
+		style, err := out.GetStyle(styleId)
+		if err != nil {
+			return err
+		}
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFC7CE"}}
+
+		if highlighted, err = out.NewStyle(style); err != nil {
+			return err
+		}
+		highlights[styleId] = highlighted
+	}
+
+	return out.SetCellStyle(sheet, cell, cell, highlighted)
+}
+
+// Returns the annotated copy of the upload written by WriteMapping if MappingInstruction.AnnotateErrors was set.
+// The caller has to close the returned reader.
+func (svc *mappingService) ErrorReport(uploadUuid string) (io.ReadCloser, error) {
+	data, err := svc.uploads().Get(uploadUuid, reportFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errReportNotFound(uploadUuid)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{Code: ErrCodeStorageFailed})
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func errReportNotFound(uploadUuid string) *Error {
+	return newError(Error{Code: ErrCodeReportNotFound, args: map[string]any{"uuid": uploadUuid}})
+}
@@ -0,0 +1,168 @@
+package dataimport
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestWriteMappingErrorReport(t *testing.T) {
+	uploads := map[string][]byte{
+		"xlsx": newTestWorkbook(t, [][]string{
+			{"ArtNr", "Bestand"},
+			{"31161", "12"},
+			{"99999", "3"},
+		}),
+		"csv": []byte("ArtNr;Bestand\n31161;12\n99999;3\n"),
+	}
+
+	for name, upload := range uploads {
+		t.Run(name, func(t *testing.T) {
+			svc := &mappingService{
+				hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+					list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+						return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+					},
+					read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+						return &hardware.HardwareCRUD{
+							Id:       "hw1",
+							Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161"}},
+						}, nil
+					},
+					update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+						return h, nil
+					},
+				},
+			}
+
+			options, err := svc.ReadFile(&UploadData{
+				UploadedFile: bytes.NewReader(upload),
+				UploadType:   "stocks",
+			})
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+
+			result, err := svc.WriteMapping(&MappingInstruction{
+				Uuid: options.Uuid,
+				Mapping: []MappingObject{
+					{ColIndex: 1, MappingValue: "externalArticleNumber"},
+					{ColIndex: 2, MappingValue: "currentStock"},
+				},
+				UploadType:     "stocks",
+				AnnotateErrors: true,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, result.UnsuccessfulRows)
+			assert.True(t, result.ErrorReport)
+
+			reader, err := svc.ErrorReport(options.Uuid)
+			if !assert.NoError(t, err, "report should be kept after the import") {
+				return
+			}
+			defer reader.Close()
+
+			report, err := excelize.OpenReader(reader)
+			if err != nil {
+				t.Fatalf("opening report failed: %v", err)
+			}
+			defer report.Close()
+
+			sheet := report.GetSheetList()[0]
+			rows, _ := report.GetRows(sheet)
+			assert.Equal(t, []string{"ArtNr", "Bestand", "Importstatus"}, rows[0])
+			assert.Equal(t, "OK", rows[1][2])
+			assert.Contains(t, rows[2][2], "Es konnte keine Variante mit dem Identifikator '99999' gefunden werden")
+
+			comments, err := report.GetComments(sheet)
+			assert.NoError(t, err)
+			if assert.Len(t, comments, 1) {
+				assert.Equal(t, "A3", comments[0].Cell)
+			}
+
+			styleId, _ := report.GetCellStyle(sheet, "A3")
+			style, err := report.GetStyle(styleId)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []string{"FFC7CE"}, style.Fill.Color)
+			}
+		})
+	}
+}
+
+func TestWriteMappingErrorReportConsumesUpload(t *testing.T) {
+	updates := 0
+	store := NewMemoryUploadStore()
+	svc := &mappingService{
+		uploadStore: store,
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				if o[0].Value == "99999" {
+					return nil, nil
+				}
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return &hardware.HardwareCRUD{
+					Id:       "hw1",
+					Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161"}},
+				}, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				updates++
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n99999;3\n")),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	mi := &MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType:     "stocks",
+		AnnotateErrors: true,
+	}
+	result, err := svc.WriteMapping(mi)
+	assert.NoError(t, err)
+	assert.True(t, result.ErrorReport)
+	assert.Equal(t, 1, updates)
+
+	// Only the error report is kept, the upload can't be imported a second time
+	_, err = svc.WriteMapping(mi)
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeUploadImported, importErr.Code)
+	}
+	assert.Equal(t, 1, updates, "rows are written once")
+
+	_, err = store.Get(options.Uuid, csvFileName)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	reader, err := svc.ErrorReport(options.Uuid)
+	if assert.NoError(t, err) {
+		reader.Close()
+	}
+}
+
+func TestErrorReportNotFound(t *testing.T) {
+	svc := &mappingService{}
+
+	_, err := svc.ErrorReport("../../etc")
+	assert.Error(t, err)
+
+	_, err = svc.ErrorReport("0b0c4bd0-5ad6-4b0e-9d25-4b52cbd0e0a1")
+	assert.Error(t, err)
+}
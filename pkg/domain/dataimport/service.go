@@ -1,12 +1,14 @@
 package dataimport
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/crud"
@@ -16,113 +18,165 @@ import (
 	"github.com/Filipza/excel-mapping-tool/internal/settings"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
-	"github.com/xuri/excelize/v2"
 )
 
-var DROPDOWN_OPTIONS = map[string]map[string]string{
-	"tariff": {
-		"ebootisId":          "EbootisId",
-		"basicCharge":        "Preis monatlich",
-		"basicChargeRenewal": "Preis monatlich nach Aktionszeitraum",
-		"leadType":           "Lead Type",
-		"provision":          "Marktprämie",
-		"xProvision":         "Onlineprämie",
-		"connectionFee":      "Anschlussgebühr (ohne EUR-Zeichen)",
-		"dataVolume":         "Inkl. Datenvolumen in GB",
-		"legalNote":          "Legalnote",
-		"pibLink":            "Pib-URL",
-		"highlight1":         "Highlight 1",
-		"highlight2":         "Highlight 2",
-		"highlight3":         "Highlight 3",
-		"highlight4":         "Highlight 4",
-		"highlight5":         "Highlight 5",
-		"bullet1":            "Inklusiv-Benefit 1",
-		"bullet2":            "Inklusiv-Benefit 2",
-		"bullet3":            "Inklusiv-Benefit 3",
-		"bullet4":            "Inklusiv-Benefit 4",
-		"bullet5":            "Inklusiv-Benefit 5",
-		"bullet6":            "Inklusiv-Benefit 6",
-		"supplierWkz":        "Supplier WKZ",
-		"tariffWkz":          "Tariff WKZ",
-	},
-	"hardware": {
-		"ebootisId":             "EbootisId",
-		"externalArticleNumber": "Exerterne Artikelnr.",
-		"price":                 "EK",
-		"manufactWkz":           "Manufacturer WKZ",
-		"ek24Wkz":               "ek24 WKZ",
-	},
-	"stocks": {
-		"ebootisId":             "EbootisId",
-		"externalArticleNumber": "Exerterne Artikelnr.",
-		"currentStock":          "Stock aktuell",
-		"originalStock":         "Stock original",
-	},
-}
-
 type MappingService interface {
 	ReadFile(*UploadData) (*MappingOptions, error)
 	WriteMapping(*MappingInstruction) (*MappingResult, error)
+	// ReadFile, stopped once ctx is done
+	ReadFileContext(context.Context, *UploadData) (*MappingOptions, error)
+	// WriteMapping, stopped once ctx is done. Returns the partial result of a cancelled import, see MappingResult.Cancelled.
+	WriteMappingContext(context.Context, *MappingInstruction) (*MappingResult, error)
+	// Progress of the import started with MappingInstruction.Async
+	JobStatus(uuid string) (*JobStatus, error)
+	// Streams the progress of the import started with MappingInstruction.Async until it is finished or ctx is done
+	WatchJob(ctx context.Context, uuid string) (<-chan JobStatus, error)
+	CancelJob(uuid string) error
+	ErrorReport(uuid string) (io.ReadCloser, error)
+	ListTemplates(uploadType string) ([]*MappingTemplate, error)
+	SaveTemplate(*MappingTemplate) error
+	DeleteTemplate(uploadType string, name string) error
+	RevertImport(uuid string) (*RevertResult, error)
+	// Removes the uploads of expired sessions, to be called periodically
+	SweepSessions() (int, error)
 }
 
 type mappingService struct {
-	chanMap         sync.Map
+	jobs            sync.Map // upload uuid → *importJob
 	tariffAdapter   crud.CRUDService[tariff.TariffCRUD, tariff.TariffLookup]
 	hardwareAdapter crud.CRUDService[hardware.HardwareCRUD, hardware.HardwareLookup]
+	templateStore   TemplateStore
+	historyStore    HistoryStore
+	uploadStore     UploadStore
+	sessionTTL      time.Duration
+	limits          UploadLimits
+	activeSessions  activeSessions
+	workers         int
+	backendTimeout  time.Duration
+}
+
+// Configures optional dependencies of the MappingService
+type ServiceOption func(*mappingService)
+
+// Enables saved mapping templates
+func WithTemplateStore(store TemplateStore) ServiceOption {
+	return func(svc *mappingService) {
+		svc.templateStore = store
+	}
 }
 
-func NewMappingService(tariffAdapter crud.CRUDService[tariff.TariffCRUD, tariff.TariffLookup], hardwareAdapter crud.CRUDService[hardware.HardwareCRUD, hardware.HardwareLookup]) MappingService {
-	return &mappingService{tariffAdapter: tariffAdapter, hardwareAdapter: hardwareAdapter}
+// Processes the rows of an import with the given number of workers. Rows are processed one after another if not set.
+func WithWorkers(workers int) ServiceOption {
+	return func(svc *mappingService) {
+		svc.workers = workers
+	}
+}
+
+// Bounds every call of the tariff and hardware backends by the timeout
+func WithBackendTimeout(timeout time.Duration) ServiceOption {
+	return func(svc *mappingService) {
+		svc.backendTimeout = timeout
+	}
+}
+
+// Keeps a record of every import, so it can be reverted via MappingService.RevertImport
+func WithHistoryStore(store HistoryStore) ServiceOption {
+	return func(svc *mappingService) {
+		svc.historyStore = store
+	}
+}
+
+// Stores uploads in the given UploadStore instead of the temp directory of the host
+func WithUploadStore(store UploadStore) ServiceOption {
+	return func(svc *mappingService) {
+		svc.uploadStore = store
+	}
+}
+
+// Time uploads are kept until they are imported. Defaults to 30 minutes.
+func WithSessionTTL(ttl time.Duration) ServiceOption {
+	return func(svc *mappingService) {
+		svc.sessionTTL = ttl
+	}
+}
+
+// Bounds the uploads accepted by ReadFile. DefaultUploadLimits apply if not set.
+func WithUploadLimits(limits UploadLimits) ServiceOption {
+	return func(svc *mappingService) {
+		svc.limits = limits
+	}
+}
+
+func NewMappingService(tariffAdapter crud.CRUDService[tariff.TariffCRUD, tariff.TariffLookup], hardwareAdapter crud.CRUDService[hardware.HardwareCRUD, hardware.HardwareLookup], opts ...ServiceOption) MappingService {
+	svc := &mappingService{tariffAdapter: tariffAdapter, hardwareAdapter: hardwareAdapter}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
 }
 
 func (svc *mappingService) ReadFile(ud *UploadData) (*MappingOptions, error) {
+	return svc.ReadFileContext(context.Background(), ud)
+}
+
+func (svc *mappingService) ReadFileContext(ctx context.Context, ud *UploadData) (*MappingOptions, error) {
+	options, err := svc.readFile(ctx, ud)
+	return options, localizeError(err, ud.Locale)
+}
+
+func (svc *mappingService) readFile(ctx context.Context, ud *UploadData) (*MappingOptions, error) {
 	// Assign Uuid in case of e.g cli/standalone application upload
 	if ud.Uuid == "" {
 		ud.Uuid = uuid.New().String()
 	}
 
-	// Creation of dir in linux temp folder named after uuid
-	dirPath := "/tmp/" + ud.Uuid + "/"
-	err := os.MkdirAll(dirPath, 0755)
-	if err != nil {
-		return nil, &Error{
-			ErrTitle: "Verzeichnisfehler",
-			ErrMsg:   "Verzeichnis konnte nicht erstellt werden",
-		}
+	// The uuid names the stored upload, so it must not be able to address anything else
+	if !validUuid(ud.Uuid) {
+		return nil, newError(Error{Code: ErrCodeUuidInvalid, args: map[string]any{"uuid": ud.Uuid}})
 	}
 
-	// Removal of dir after timeout. Cancelled as soon as writeMapping() starts
-	cleanupCh := make(chan bool)
-	svc.chanMap.Store(ud.Uuid, cleanupCh)
-
-	go func(dirPath string, ch <-chan bool) {
-		timer := time.NewTimer(1800 * time.Second)
+	// Check if UploadType exists in available dropdown options before anything is read or stored
+	if _, exists := DROPDOWN_OPTIONS[ud.UploadType]; !exists {
+		return nil, newError(Error{Code: ErrCodeUploadTypeUnknown, args: map[string]any{"uploadType": ud.UploadType}})
+	}
 
-		select {
-		case <-timer.C:
-			os.RemoveAll(dirPath)
-		case <-ch:
-			return
-		}
-	}(dirPath, cleanupCh)
+	limits := svc.limits.withDefaults()
 
-	file, err := excelize.OpenReader(ud.UploadedFile)
+	// Reads one byte more than allowed to tell files of exactly the maximum size from larger ones
+	reader := ud.UploadedFile
+	if limits.MaxBytes > 0 {
+		reader = io.LimitReader(reader, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(reader)
 	if err != nil {
 		log.Error(err)
-		return nil, &Error{
-			ErrTitle: "Parsingfehler",
-			ErrMsg:   "Datei konnte nicht verarbeitet werden und möglicherweise korrupt.",
-		}
+		return nil, newError(Error{Code: ErrCodeFileParseFailed})
+	}
+	if exceeds(int64(len(data)), limits.MaxBytes) {
+		return nil, ErrUploadTooLarge(limits.MaxBytes)
+	}
+	if ctx.Err() != nil {
+		return nil, errCancelled()
 	}
-	defer file.Close()
 
-	err = file.SaveAs(dirPath + "data.xlsx")
+	if err := limits.checkUncompressed(data); err != nil {
+		return nil, err
+	}
+
+	// Accepts xlsx as well as csv/tsv
+	file, fileName, err := parseUpload(data)
 	if err != nil {
 		log.Error(err)
-		return nil, &Error{
-			ErrTitle: "Speicherfehler",
-			ErrMsg:   "Datei konnte nicht abespeichert werden.",
-		}
+		return nil, newError(Error{Code: ErrCodeFileParseFailed})
+	}
+	defer file.Close()
+
+	if err := limits.checkTable(file); err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return nil, errCancelled()
 	}
 
 	mappingOptions := MappingOptions{
@@ -130,382 +184,849 @@ func (svc *mappingService) ReadFile(ud *UploadData) (*MappingOptions, error) {
 		Uuid:         ud.Uuid,
 	}
 
-	var exists bool
-	// Check if UploadType exists in available dropdown options
-	mappingOptions.DropdownOptions, exists = DROPDOWN_OPTIONS[ud.UploadType]
-	if !exists {
-		return nil, &Error{
-			ErrTitle: "Fehlender/falscher Uploadtyp",
-			ErrMsg:   fmt.Sprintf("Der Uploadtype %s ist unbekannt", ud.UploadType),
-		}
-	}
+	mappingOptions.DropdownOptions, _ = localizedDropdownOptions(ud.UploadType, ud.Locale)
 
 	sheetLists := file.GetSheetList()
 	if len(sheetLists) == 0 {
 		log.Debug(err)
-		return nil, &Error{
-			ErrTitle: "Fehlerhafte Excel-Datei",
-			ErrMsg:   "Datei enthält keine Arbeitsblätter",
+		return nil, newError(Error{Code: ErrCodeNoSheets})
+	}
+
+	sheet, sheetErr := selectSheet(sheetLists, ud.Sheet)
+	if sheetErr != nil {
+		return nil, sheetErr
+	}
+	mappingOptions.Sheet = sheet
+
+	for _, name := range sheetLists {
+		preview, err := readPreview(file, name, sheetPreviewRows)
+		if err != nil {
+			log.Debug(err)
+			return nil, newError(Error{Code: ErrCodeFileParseFailed})
 		}
+		mappingOptions.Sheets = append(mappingOptions.Sheets, SheetPreview{Name: name, Rows: preview})
 	}
 
-	rows, err := file.Rows(sheetLists[0])
+	// Top rows of the sheet to detect the header row in, plus the sample rows below it
+	top, err := readPreview(file, sheet, max(headerScanRows, ud.HeaderRow)+sampleRows)
 	if err != nil {
 		log.Debug(err)
-		return nil, &Error{
-			ErrTitle: "Parsingfehler",
-			ErrMsg:   "Es is ein Fehler beim Lesen der Reihen aufgetreten. Überprüfe die Datei.",
-		}
+		return nil, newError(Error{Code: ErrCodeFileParseFailed})
 	}
 
-	for i := 0; i < 4 && rows.Next(); i++ {
-		cols, err := rows.Columns()
+	headerRow := ud.HeaderRow
+	if headerRow <= 0 {
+		headerRow = detectHeaderRow(top)
+	}
+	mappingOptions.HeaderRow = headerRow
 
-		if err != nil {
-			log.Debug(err)
-			return nil, &Error{
-				ErrTitle: "Parsingfehler",
-				ErrMsg:   "Es is ein Fehler beim Lesen der Reihen aufgetreten. Überprüfe die Datei.",
-			}
-		}
+	if headerRow > len(top) || len(top[headerRow-1]) == 0 {
+		log.Debug(errors.New("header row is empty"))
+		return nil, newError(Error{Code: ErrCodeHeaderRowEmpty, Row: headerRow})
+	}
+	mappingOptions.TableHeaders = top[headerRow-1]
 
-		if len(cols) == 0 {
-			log.Debug(errors.New("first row is empty"))
-			return nil, &Error{
-				ErrTitle: "Leerzeile",
-				ErrMsg:   "Die erste Zeile der Datei ist leer. Diese muss für den Import die Tabellenköpfe enthalten.",
-			}
+	for _, cols := range top[headerRow:] {
+		if len(mappingOptions.TableSummary) == sampleRows {
+			break
 		}
-
-		if i == 0 {
-			mappingOptions.TableHeaders = cols
-			continue
+		if len(cols) > 0 {
+			mappingOptions.TableSummary = append(mappingOptions.TableSummary, cols)
 		}
+	}
+
+	mappingOptions.Templates = svc.matchingTemplates(ud.UploadType, mappingOptions.TableHeaders)
+	mappingOptions.Suggestions = uploadTypeFields[ud.UploadType].suggest(mappingOptions.TableHeaders, mappingOptions.TableSummary)
 
-		mappingOptions.TableSummary = append(mappingOptions.TableSummary, cols)
+	// Stored only once the upload passed all checks. It is removed by SweepSessions once its session expired.
+	if err := svc.storeUpload(ud, fileName, data); err != nil {
+		return nil, err
 	}
 
 	return &mappingOptions, nil
 }
 
 func (svc *mappingService) WriteMapping(mi *MappingInstruction) (*MappingResult, error) {
-	// Remove uploaded/generated files
-	defer os.RemoveAll("/tmp/" + mi.Uuid + "/")
+	return svc.WriteMappingContext(context.Background(), mi)
+}
 
-	// Send signal to cancel the cleanup routine
-	if cancelInfo, ok := svc.chanMap.Load(mi.Uuid); ok {
-		if cancelChan, ok := cancelInfo.(chan bool); ok {
-			cancelChan <- true
-		}
+func (svc *mappingService) WriteMappingContext(ctx context.Context, mi *MappingInstruction) (*MappingResult, error) {
+	if mi.Async {
+		result, err := svc.startJob(ctx, mi)
+		return result, localizeError(err, mi.Locale)
 	}
 
-	// Check if upload type valid
-	switch mi.UploadType {
-	case "tariff", "hardware":
-		break
-	default:
-		return nil, &Error{
-			ErrTitle: "Ungültiger Uploadtype",
-			ErrMsg:   "Der übergebene Uploadtyp '%s' ist ungültig.",
-		}
+	result, err := svc.writeMapping(ctx, mi, nil)
+	return result, localizeError(err, mi.Locale)
+}
+
+// Runs the import. Progress is reported to the background job running the import, nil if run synchronously.
+func (svc *mappingService) writeMapping(ctx context.Context, mi *MappingInstruction, progress *importJob) (*MappingResult, error) {
+	if !validUuid(mi.Uuid) {
+		return nil, newError(Error{Code: ErrCodeUploadNotFound, args: map[string]any{"uuid": mi.Uuid}})
 	}
 
 	result := &MappingResult{}
 
+	if err := validateMapping(mi.UploadType, mi.Mapping); err != nil {
+		return nil, err
+	}
+
+	if !mi.NumberFormat.valid() {
+		return nil, errNumberFormatUnknown(mi.NumberFormat)
+	}
+
 	// Check if identifier exists and get according column index + type (ebootisId or externalArticleNo)
 	exists, idIndex, idType := mi.GetIdentifierIndex()
-	idCol := idIndex + 1
-
 	if !exists {
-		return nil, &Error{
-			ErrTitle: "Fehlende EbootisID / externe Artikelnummer",
-			ErrMsg:   "Keine der Spalten wurde der EbootisID / externen Artikelnummer zugewiesen",
-		}
+		return nil, newError(Error{Code: ErrCodeIdentifierMissing})
+	}
+	idCol := mi.Mapping[idIndex].ColIndex
+
+	// Keeps the sweeper from removing the upload while it is imported, even if its session expires meanwhile.
+	// The session is checked once acquired, so an upload removed just before is found expired.
+	svc.activeSessions.acquire(mi.Uuid)
+	defer svc.activeSessions.release(mi.Uuid)
+
+	session, err := svc.session(mi.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dry runs keep the upload and its session, so the mapping can be committed afterwards
+	if !mi.DryRun {
+		// Remove uploaded/generated files. Only the error report is kept for another session TTL.
+		defer func() {
+			if result.ErrorReport {
+				err := svc.consumeSession(session)
+				if err == nil {
+					return
+				}
+				log.Error(err)
+				result.ErrorReport = false
+			}
+			svc.closeSession(mi.Uuid)
+		}()
 	}
 
-	file, err := excelize.OpenFile("/tmp/" + mi.Uuid + "/data.xlsx")
+	file, err := openUpload(svc.uploads(), mi.Uuid)
 	if err != nil {
-		return nil, &Error{
-			ErrTitle: "Fehler beim Öffnen der Datei",
-			ErrMsg:   "Die zu bearbeitende Excel-Datei konnte nicht geöffnet werden",
+		code := ErrCodeFileParseFailed
+		if errors.Is(err, os.ErrNotExist) {
+			code = ErrCodeUploadNotFound
 		}
+		return nil, newError(Error{Code: code, args: map[string]any{"uuid": mi.Uuid}})
 	}
 	defer file.Close()
 
 	sheetLists := file.GetSheetList()
 	if len(sheetLists) == 0 {
 		log.Debug(err)
-		return nil, &Error{
-			ErrTitle: "Fehlerhafte Excel-Datei",
-			ErrMsg:   "Datei enthält keine Arbeitsblätter",
+		return nil, newError(Error{Code: ErrCodeNoSheets})
+	}
+
+	sh, sheetErr := selectSheet(sheetLists, mi.Sheet)
+	if sheetErr != nil {
+		return nil, sheetErr
+	}
+
+	firstRow, lastRow, rangeErr := mi.DataRange()
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	edited := newEditedHardwareMap()
+	lookups := svc.newImportLookups()
+	report := newImportReport(max(mi.HeaderRow, 1), idCol, mi.Locale)
+	journal := &importJournal{}
+
+	// Position of each entity in result.Changes, so rows changing the same entity extend a single change
+	changeIndex := make(map[string]int)
+	addChange := func(change EntityChange) {
+		key := change.EntityType + "/" + change.EntityId
+		if i, ok := changeIndex[key]; ok {
+			mergeChange(&result.Changes[i], change)
+			return
 		}
+		changeIndex[key] = len(result.Changes)
+		result.Changes = append(result.Changes, change)
 	}
 
-	editedCRUDmap := make(map[string]*editedCRUDobj)
+	// Records the failure of a row in the result as well as in the error report
+	fail := func(row int, rowErr Error) {
+		rowErr.Row = row
+		rowErr.Localize(mi.Locale)
+		result.FailedRows = append(result.FailedRows, rowErr)
+		report.fail(row, rowErr)
+	}
 
-	sh := sheetLists[0]
-	rows, _ := file.Rows(sh)
+	// Transactional imports are rolled back as soon as more rows failed than tolerated
+	exceeded := func() bool {
+		return mi.Transactional && report.failedRows > mi.MaxFailedRows
+	}
+	var aborted atomic.Bool
 
-	for row := 1; rows.Next(); row++ {
+	// Lookups and updates against the backends, run by the workers of the pool
+	process := func(job *rowJob) {
+		if aborted.Load() || ctx.Err() != nil {
+			job.aborted = true
+			return
+		}
 
-		if row == 1 {
-			continue // Skip header row
+		switch mi.UploadType {
+		case "tariff":
+			job.err = svc.updateTariff(ctx, lookups, mi, job.values, job.identifierValue, job.row, &job.changes, &job.journal)
+		case "hardware", "stocks":
+			job.hardware, job.err = svc.lookupHardware(ctx, lookups, job.identifierValue, idType, job.row, edited)
 		}
+	}
 
-		idCoords, err := excelize.CoordinatesToCellName(idCol, row)
-		if err != nil {
-			result.FailedRows = append(result.FailedRows, Error{
-				ErrTitle: "Koordinatenfehler",
-				ErrMsg:   fmt.Sprintf("Identifikationskoordinate konnte in Zeile %v nicht in Zellname umgewandelt werden", row),
-			})
-			continue
+	// Records the outcome of a row. Called in row order, one row at a time.
+	apply := func(job *rowJob) {
+		// Entities written by rows processed after an abort are still rolled back
+		journal.entries = append(journal.entries, job.journal.entries...)
+		if job.aborted || aborted.Load() {
+			return
 		}
-		identifierValue, err := file.GetCellValue(sh, idCoords)
-		if err != nil {
-			result.FailedRows = append(result.FailedRows, Error{
-				ErrTitle: "Zellen-Lesefehler",
-				ErrMsg:   fmt.Sprintf("Der Zelleninhalt der Zelle %s konnte nicht gelesen werden", idCoords),
-			})
-			continue
+		// Rows interrupted by the cancellation are neither successful nor failed
+		if job.err != nil && ctx.Err() != nil {
+			return
 		}
+		defer func() {
+			progress.advance(result)
+			if exceeded() {
+				aborted.Store(true)
+			}
+		}()
 
-		var updateErr *Error
+		if job.readErr != nil {
+			fail(job.row, *job.readErr)
+			return
+		}
 
-		switch mi.UploadType {
-		case "tariff":
-			updateErr = svc.updateTariff(mi, file, identifierValue, row, sh)
-		case "hardware":
-			updateErr = svc.updateHardware(mi, file, identifierValue, idType, row, sh, editedCRUDmap)
+		// Rows with invalid cells are rejected before anything is looked up, unless invalid fields are to be skipped
+		if len(job.cellErrs) > 0 {
+			result.UnsuccessfulRows++
+			for _, cellErr := range job.cellErrs {
+				fail(job.row, cellErr)
+			}
+			return
+		}
+		for _, cellErr := range job.skipped {
+			result.SkippedFields = append(result.SkippedFields, *cellErr.Localize(mi.Locale))
+		}
+		for _, change := range job.changes {
+			addChange(change)
+		}
+
+		updateErr := job.err
+		if updateErr == nil && job.hardware != nil {
+			fields := hardwareFields
+			if mi.UploadType == "stocks" {
+				fields = stockFields
+			}
+			updateErr = editHardware(mi, fields, job.hardware, job.values, job.identifierValue, idType, job.row)
 		}
 
 		if updateErr != nil {
+			// Errors without cell refer to the identifier of the row
+			if updateErr.Column == 0 {
+				updateErr.Column = idCol
+				updateErr.CellRef = cellRef(idCol, job.row)
+				updateErr.Field = idType
+				updateErr.RawValue = job.identifierValue
+			}
+
 			result.UnsuccessfulRows++
-			result.FailedRows = append(result.FailedRows, *updateErr)
-			continue
+			fail(job.row, *updateErr)
+			return
 		}
 		result.SuccessfulRows++
+		report.success(job.row)
+	}
+
+	if progress != nil {
+		progress.begin(countRows(file, sh, firstRow, lastRow))
+	}
+
+	// Identifiers are listed in bulk if the backend supports it, otherwise the cache of the import saves
+	// repeated lookups of the same identifier
+	if svc.canPrefetch(mi.UploadType) {
+		identifiers := collectIdentifiers(file, sh, idCol, firstRow, lastRow, mi.StopAtEmptyRow)
+		svc.prefetch(ctx, lookups, mi.UploadType, idType, identifiers)
 	}
 
-	if len(editedCRUDmap) > 0 {
-		for _, v := range editedCRUDmap {
+	rows, err := file.Rows(sh)
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{Code: ErrCodeFileParseFailed})
+	}
+	defer rows.Close()
+
+	pool := newRowPool(svc.workers, process, apply)
+
+	// Every row is read once in order, so only the current row of the sheet is held in memory
+	for row := 1; rows.Next(); row++ {
+
+		if aborted.Load() || ctx.Err() != nil {
+			break
+		}
+
+		if row < firstRow {
+			continue // Skip header row and everything above it
+		}
+
+		if lastRow > 0 && row > lastRow {
+			break
+		}
+
+		job := &rowJob{row: row}
+
+		cols, err := rows.Columns()
+		if err != nil {
+			job.readErr = &Error{Code: ErrCodeCellReadFailed, Row: row, Column: idCol, CellRef: cellRef(idCol, row), Field: idType}
+			pool.submit(job, "")
+			continue
+		}
+
+		if mi.StopAtEmptyRow && isEmptyRow(cols) {
+			break
+		}
+
+		identifierValue := cellAt(cols, idCol)
+		job.identifierValue = identifierValue
+
+		// Rows without identifier would look up and write whatever the backend returns for an empty filter, so they
+		// are rejected whatever the empty cell policy of the identifier, even if invalid fields are to be skipped
+		if strings.TrimSpace(identifierValue) == "" {
+			job.cellErrs = []Error{*newError(Error{Code: ErrCodeCellEmpty, Row: row, Column: idCol, CellRef: cellRef(idCol, row), Field: idType})}
+			pool.submit(job, "")
+			continue
+		}
+
+		values, cellErrs := readRow(uploadTypeFields[mi.UploadType], mi, cols, rows, row)
+		job.values = values
+		if mi.SkipInvalidFields {
+			job.skipped = cellErrs
+		} else {
+			job.cellErrs = cellErrs
+		}
+
+		// Rows of the same identifier write the same entities, so they are kept in order
+		pool.submit(job, identifierValue)
+	}
+	pool.wait()
+
+	// Hardware is written after all rows were read, so nothing has to be written if the import is rolled back anyway
+	if !exceeded() {
+		for _, v := range edited.list() {
+			if exceeded() || ctx.Err() != nil {
+				break
+			}
 			if !v.hasError {
+				if mi.DryRun {
+					change, changed, err := entityChange("hardware", v.hardwareCRUD.Id, v.original, v.hardwareCRUD)
+					if err != nil {
+						log.Error(err)
+					}
+					if changed {
+						addChange(change)
+					}
+					continue
+				}
+
 				// Write into db
-				if _, err := svc.hardwareAdapter.Update(v.hardwareCRUD.Id, v.hardwareCRUD); err != nil {
-					result.FailedRows = append(result.FailedRows, Error{
-						ErrTitle: "Hardware Speicherfehler",
-						ErrMsg:   fmt.Sprintf("Update von Eardware %s konnte nicht durchgeführt werden", v.hardwareCRUD.Id),
-					})
+				written, err := svc.hardwareBackend().UpdateContext(ctx, v.hardwareCRUD.Id, v.hardwareCRUD)
+				if err != nil {
+					log.Error(err)
+					if ctx.Err() != nil {
+						break
+					}
+					// Reported once per row that edited the hardware
+					for _, row := range v.rows {
+						fail(row, Error{Code: ErrCodeUpdateFailed, Row: row, EntityId: v.hardwareCRUD.Id})
+					}
+					continue
 				}
+
+				id, before := v.hardwareCRUD.Id, v.snapshot
+				journal.record(journalEntry{
+					entityType: "hardware",
+					entityId:   id,
+					before:     v.snapshot,
+					after:      writtenState(written, v.hardwareCRUD),
+					restore: func(ctx context.Context) error {
+						_, err := svc.hardwareBackend().UpdateContext(ctx, id, before)
+						return err
+					},
+				})
 			}
 		}
 	}
 
+	result.Cancelled = ctx.Err() != nil
+	result.Lookups = lookups.stats()
+
+	if !mi.DryRun {
+		// Cancelled transactional imports are rolled back as well, which mustn't be stopped by the cancellation
+		if exceeded() || (mi.Transactional && result.Cancelled) {
+			rollback(context.WithoutCancel(ctx), journal, result, mi.Locale)
+		}
+		svc.recordImport(mi, journal, result.RolledBack)
+	}
+
+	if mi.AnnotateErrors {
+		if data, err := report.write(file, sh); err != nil {
+			log.Error(err)
+		} else if err := svc.uploads().Put(mi.Uuid, reportFileName, data, svc.retention()); err != nil {
+			log.Error(err)
+		} else {
+			result.ErrorReport = true
+		}
+	}
+
 	return result, err
 }
 
-func (svc *mappingService) updateTariff(mi *MappingInstruction, file *excelize.File, identifierValue string, row int, sh string) *Error {
-	listResult, err := svc.tariffAdapter.List(settings.Option{Name: "ebootis_id", Value: identifierValue})
-	log.Error(err)
+// Number of rows per sheet returned as preview by ReadFile
+const sheetPreviewRows = 5
+
+// Number of rows below the headers returned as TableSummary by ReadFile
+const sampleRows = 3
+
+// Number of rows searched for the header row by ReadFile
+const headerScanRows = 20
+
+// Guesses the 1-based header row from the top rows of a sheet. Titles, logos and blank rows above the
+// headers usually fill fewer columns, so the first row filling most of the table width with text is taken.
+func detectHeaderRow(top [][]string) int {
+	widest := 0
+	for _, cols := range top {
+		widest = max(widest, countNonEmpty(cols))
+	}
+
+	for i, cols := range top {
+		filled := countNonEmpty(cols)
+		if filled == 0 || filled*10 < widest*6 {
+			continue
+		}
+
+		onlyText := true
+		for _, c := range cols {
+			if strings.TrimSpace(c) != "" && looksNumeric(c) {
+				onlyText = false
+				break
+			}
+		}
+		if onlyText {
+			return i + 1
+		}
+	}
+
+	// Fall back to the first row which isn't empty
+	for i, cols := range top {
+		if countNonEmpty(cols) > 0 {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+func countNonEmpty(cols []string) int {
+	count := 0
+	for _, c := range cols {
+		if strings.TrimSpace(c) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func isEmptyRow(cols []string) bool {
+	return countNonEmpty(cols) == 0
+}
+
+// Counts the rows of the sheet within the data range, to estimate the progress of an import
+func countRows(file tableSource, sheet string, firstRow int, lastRow int) int {
+	rows, err := file.Rows(sheet)
 	if err != nil {
-		return &Error{
-			ErrTitle: "Identifizierungs-Fehler",
-			ErrMsg:   fmt.Sprintf("Fehler in Zeile %d. Es konnten keine Tarifobjekte mit der EbootisId '%s' ermittelt werden", row, identifierValue),
+		return 0
+	}
+	defer rows.Close()
+
+	count := 0
+	for row := 1; rows.Next(); row++ {
+		if lastRow > 0 && row > lastRow {
+			break
+		}
+		if row >= firstRow {
+			count++
 		}
 	}
-	for _, lookupObj := range listResult {
-		tariffObj, err := svc.tariffAdapter.Read(lookupObj.Id)
-		log.Error(err)
+	return count
+}
+
+// Returns the requested sheet if present in the file, the first sheet if none is requested
+func selectSheet(sheetLists []string, requested string) (string, *Error) {
+	if requested == "" {
+		return sheetLists[0], nil
+	}
+
+	for _, sheet := range sheetLists {
+		if sheet == requested {
+			return sheet, nil
+		}
+	}
+
+	return "", newError(Error{Code: ErrCodeSheetNotFound, args: map[string]any{"sheet": requested}})
+}
+
+// Returns up to n rows from the top of the sheet
+func readPreview(file tableSource, sheet string, n int) ([][]string, error) {
+	rows, err := file.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preview := make([][]string, 0, n)
+	for len(preview) < n && rows.Next() {
+		cols, err := rows.Columns()
 		if err != nil {
-			return &Error{
-				ErrTitle: "Identifizierungs-Fehler",
-				ErrMsg:   fmt.Sprintf("Fehler in Zeile %d. Es konnten kein Tarifobjekt mit der Id %s ermittelt werden.", row, lookupObj.Id),
-			}
+			return nil, err
 		}
+		preview = append(preview, cols)
+	}
+	return preview, nil
+}
 
-		highlightArr := make([]string, 5)
-		copy(highlightArr, tariffObj.Highlights)
+// Checks if the upload type is valid and all mapped fields are known for it. Empty mapping values mark ignored columns.
+func validateMapping(uploadType string, mapping []MappingObject) *Error {
+	fields, ok := uploadTypeFields[uploadType]
+	if !ok {
+		return newError(Error{Code: ErrCodeUploadTypeUnknown, args: map[string]any{"uploadType": uploadType}})
+	}
 
-		for _, inst := range mi.Mapping {
-			coords, err := excelize.CoordinatesToCellName(inst.ColIndex, row)
-			if err != nil {
-				return &Error{
-					ErrTitle: "Koordinatenfehler",
-					ErrMsg:   fmt.Sprintf("Fehler in Zeile %d, Spalte %d. Es die dazugehörige Excel-Koordinate konnte nicht konvertiert werden", row, inst.ColIndex),
-				}
+	for _, m := range mapping {
+		if m.MappingValue != "" && !fields.hasField(m.MappingValue) {
+			return newError(Error{
+				Code:  ErrCodeMappingFieldUnknown,
+				Field: m.MappingValue,
+				args:  map[string]any{"uploadType": uploadType},
+			})
+		}
+		if !m.EmptyCells.valid() {
+			return newError(Error{
+				Code:  ErrCodeEmptyCellsUnknown,
+				Field: m.MappingValue,
+				args:  map[string]any{"emptyCells": m.EmptyCells},
+			})
+		}
+	}
+	return nil
+}
+
+// Parses all mapped cells of the row. Cells which can't be parsed are returned as errors. Numbers are parsed in the
+// convention rows reports for their cell, in the NumberFormat of mi if rows is nil.
+func readRow(fields fieldSet, mi *MappingInstruction, cols []string, rows rowIterator, row int) ([]cellValue, []Error) {
+	values := make([]cellValue, 0, len(mi.Mapping))
+	var cellErrs []Error
+
+	for _, inst := range mi.Mapping {
+		if !fields.handles(inst.MappingValue) {
+			continue
+		}
+
+		cellVal := cellAt(cols, inst.ColIndex)
+
+		if strings.TrimSpace(cellVal) == "" {
+			// Identifiers are never cleared. Rows without identifier are rejected before, unmapped ones are left as they are.
+			if fields.identifies(inst.MappingValue) {
+				continue
 			}
-			cellVal, err := file.GetCellValue(sh, coords)
-			if err != nil {
-				return &Error{
-					ErrTitle: "Lesefehler",
-					ErrMsg:   fmt.Sprintf("Wert der Zelle %s konnte nicht ausgelesen werden", coords),
-				}
+
+			policy := inst.EmptyCells
+			if policy == EmptyCellsDefault {
+				policy = fields.emptyCells(inst.MappingValue)
 			}
 
-			switch inst.MappingValue {
-			case "basicCharge":
-				tariffObj.BasicCharge, _ = getPeriodFloat(cellVal)
+			switch policy {
+			case EmptyCellsClear:
+				values = append(values, cellValue{MappingObject: inst, raw: cellVal, clear: true})
+			case EmptyCellsError:
+				cellErrs = append(cellErrs, *newError(Error{
+					Code:    ErrCodeCellEmpty,
+					Row:     row,
+					Column:  inst.ColIndex,
+					CellRef: cellRef(inst.ColIndex, row),
+					Field:   inst.MappingValue,
+				}))
+			}
+			continue
+		}
 
-				if len(tariffObj.PricingIntervals) > 0 {
-					tariffObj.PricingIntervals[0].Price, _ = getPeriodFloat(cellVal)
-				}
+		format := mi.NumberFormat
+		if rows != nil && fields.numeric(inst.MappingValue) {
+			format = rows.cellNumberFormat(inst.ColIndex, format)
+		}
+		val, err := fields.parse(inst.MappingValue, cellVal, format)
+		if err != nil {
+			log.Debug(err)
+			cellErrs = append(cellErrs, *newError(Error{
+				Code:     ErrCodeCellParseFailed,
+				Row:      row,
+				Column:   inst.ColIndex,
+				CellRef:  cellRef(inst.ColIndex, row),
+				Field:    inst.MappingValue,
+				RawValue: cellVal,
+			}))
+			continue
+		}
+		values = append(values, cellValue{MappingObject: inst, raw: cellVal, val: val})
+	}
+	return values, cellErrs
+}
 
-				// TODO: writebullet für tariff_monthly_price > problem, da in tariff_monthly_price auch strings wie "34.99€ (ab dem 13. Monat 69.99€)" stehen
-				cellVal += " €"
-				tariffObj.Bullets = writeOptionArr(tariffObj.Bullets, "tariff_monthly_price", cellVal)
-			case "basicChargeRenewal":
-				tariffObj.BasicChargeRenewal, _ = getPeriodFloat(cellVal)
+func (svc *mappingService) updateTariff(ctx context.Context, lookups *importLookups, mi *MappingInstruction, values []cellValue, identifierValue string, row int, changes *[]EntityChange, journal *importJournal) *Error {
+	listResult, err := lookups.tariffs.ListContext(ctx, settings.Option{Name: identifierFilter(mi.UploadType, ""), Value: identifierValue})
+	if err != nil {
+		log.Error(err)
+		return newError(Error{
+			Code:     ErrCodeLookupFailed,
+			Row:      row,
+			RawValue: identifierValue,
+		})
+	}
+	for _, lookupObj := range listResult {
+		tariffObj, err := lookups.tariffs.ReadContext(ctx, lookupObj.Id)
+		if err != nil {
+			log.Error(err)
+			return newError(Error{
+				Code:     ErrCodeLookupFailed,
+				Row:      row,
+				RawValue: identifierValue,
+				EntityId: lookupObj.Id,
+			})
+		}
 
-				if len(tariffObj.PricingIntervals) > 1 {
-					tariffObj.PricingIntervals[1].Price, _ = getPeriodFloat(cellVal)
-				}
-			case "leadype":
-				tariffObj.LeadType, _ = strconv.Atoi(cellVal)
-			case "provision":
-				tariffObj.Provision, _ = getPeriodFloat(cellVal)
-			case "xProvision":
-				tariffObj.XProvision, _ = getPeriodFloat(cellVal)
-			case "connectionFee":
-				tariffObj.ConnectionFee, _ = getPeriodFloat(cellVal)
-
-				cellVal += " €" // ! Produktmanagement über Funktionsweise unterrichten
-				tariffObj.Bullets = writeOptionArr(tariffObj.Bullets, "tariff_connection_fee", cellVal)
-			case "dataVolume":
-				tariffObj.DataVolume, _ = getPeriodFloat(cellVal)
-			case "legalnote":
-				tariffObj.LegalNote = cellVal
-			case "pibLink":
-				tariffObj.PibLink = cellVal
-			case "highlight1", "highlight2", "highlight3", "highlight4", "highlight5":
-				// Extract last digit of "highlightx" key, to get array index
-				lastdigit := int(inst.MappingValue[len(inst.MappingValue)-1]) - '0'
-				highlightArr[lastdigit-1] = cellVal
-			case "bullet1", "bullet2", "bullet3", "bullet4", "bullet5", "bullet6":
-				// Extract last digit of "bulletx" key, to get according "tariff_inclusive_benefitsx" key
-				lastdigit := string(inst.MappingValue[len(inst.MappingValue)-1])
-				key := fmt.Sprintf("tariff_inclusive_benefit%s", lastdigit)
-				tariffObj.Bullets = writeOptionArr(tariffObj.Bullets, key, cellVal)
-			case "supplierWkz", "tariffWkz":
-				key := strings.TrimRight(inst.MappingValue, "Wkz")
-				tariffObj.Wkz = writeOptionArr(tariffObj.Wkz, key, cellVal)
-			}
+		original, err := flatten(tariffObj)
+		if err != nil {
+			log.Error(err)
 		}
 
-		// Reduce array to minimum length and write to tariffCRUD
-		lenDiff := 0
-		for i := len(highlightArr) - 1; i >= 0; i-- {
-			if highlightArr[i] != "" {
-				break
+		before, err := crud.Clone(tariffObj)
+		if err != nil {
+			log.Error(err)
+			return newError(Error{Code: ErrCodeInternal, Row: row, EntityId: lookupObj.Id})
+		}
+
+		tariffFields.write(tariffTarget{tariffObj}, values)
+
+		// Reduce highlights to minimum length
+		tariffObj.Highlights = trimTrailingEmpty(tariffObj.Highlights)
+
+		if mi.DryRun {
+			change, changed, err := entityChange("tariff", lookupObj.Id, original, tariffObj)
+			if err != nil {
+				log.Error(err)
+			}
+			if changed {
+				*changes = append(*changes, change)
 			}
-			lenDiff++
+			continue
 		}
-		highlightArr = highlightArr[:len(highlightArr)-lenDiff]
-		copy(tariffObj.Highlights, highlightArr)
 
 		// Write into db
-		// svc.tariffAdapter.Update(lookupObj.Id, tariffObj)
+		written, err := lookups.tariffs.UpdateContext(ctx, lookupObj.Id, tariffObj)
+		if err != nil {
+			log.Error(err)
+			return newError(Error{
+				Code:     ErrCodeUpdateFailed,
+				Row:      row,
+				EntityId: lookupObj.Id,
+			})
+		}
+
+		id := lookupObj.Id
+		journal.record(journalEntry{
+			entityType: "tariff",
+			entityId:   id,
+			before:     before,
+			after:      writtenState(written, tariffObj),
+			restore: func(ctx context.Context) error {
+				_, err := svc.tariffBackend().UpdateContext(ctx, id, before)
+				return err
+			},
+		})
+	}
+	return nil
+}
+
+// Looks up all hardware containing the variant of the row. Hardware is read once per import and edited by
+// editHardware, it is written after all rows were processed.
+func (svc *mappingService) lookupHardware(ctx context.Context, lookups *importLookups, identifierValue string, idType string, row int, edited *editedHardwareMap) ([]*editedCRUDobj, *Error) {
+	hardwareLookupList, err := lookups.hardware.ListContext(ctx, settings.Option{Name: identifierFilter("hardware", idType), Value: identifierValue})
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{
+			Code:     ErrCodeLookupFailed,
+			Row:      row,
+			RawValue: identifierValue,
+		})
+	}
+
+	result := make([]*editedCRUDobj, 0, len(hardwareLookupList))
+	for _, listResult := range hardwareLookupList {
+		hardwareObj, err := svc.editedHardware(ctx, lookups, listResult.Id, edited)
+		if err != nil {
+			return nil, newError(Error{
+				Code:     ErrCodeLookupFailed,
+				Row:      row,
+				RawValue: identifierValue,
+				EntityId: listResult.Id,
+			})
+		}
+		result = append(result, hardwareObj)
+	}
+	return result, nil
+}
+
+// Applies the values of the row to the hardware looked up for it. Rows are applied one after another in row order.
+func editHardware(mi *MappingInstruction, fields fieldRegistry[hardwareTarget], hardwareObjs []*editedCRUDobj, values []cellValue, identifierValue string, idType string, row int) *Error {
+	for _, hardwareObj := range hardwareObjs {
+		hardwareObj.rows = append(hardwareObj.rows, row)
 
-		if _, err := svc.tariffAdapter.Update(lookupObj.Id, tariffObj); err != nil {
-			return &Error{
-				ErrTitle: "Tarif Speicherfehler",
-				ErrMsg:   fmt.Sprintf("Update von Tarif %s konnte nicht durchgeführt werden", tariffObj.Id),
+		target := hardwareTarget{HardwareCRUD: hardwareObj.hardwareCRUD}
+		if fields.mapsVariant(mi.Mapping) {
+			variant, verr := findVariant(hardwareObj, identifierValue, idType)
+			if verr != nil {
+				return verr
 			}
+			target.variant = variant
 		}
+
+		fields.write(target, values)
 	}
 	return nil
 }
 
-func (svc *mappingService) updateHardware(mi *MappingInstruction, file *excelize.File, identifierValue string, idType string, row int, sh string, editedCRUDmap map[string]*editedCRUDobj) *Error {
-	var err error
-	var hardwareLookupList []*hardware.HardwareLookup
+// Tariff backend called with the context of the import, each call bounded by the backend timeout
+func (svc *mappingService) tariffBackend() crud.ContextCRUDService[tariff.TariffCRUD, tariff.TariffLookup] {
+	return crud.WithTimeout(crud.WithContext(svc.tariffAdapter), svc.backendTimeout)
+}
 
-	switch idType {
-	case "ebootisId":
-		hardwareLookupList, err = svc.hardwareAdapter.List(settings.Option{Name: "variants.ebootis_id", Value: identifierValue})
-	case "externalArticleNumber":
-		hardwareLookupList, err = svc.hardwareAdapter.List(settings.Option{Name: "variants.external_articlenumber", Value: identifierValue})
+// Hardware backend called with the context of the import, each call bounded by the backend timeout
+func (svc *mappingService) hardwareBackend() crud.ContextCRUDService[hardware.HardwareCRUD, hardware.HardwareLookup] {
+	return crud.WithTimeout(crud.WithContext(svc.hardwareAdapter), svc.backendTimeout)
+}
+
+// Used by services without an UploadStore, e.g. constructed in tests
+var defaultUploadStore = NewLocalUploadStore(os.TempDir())
+
+func (svc *mappingService) uploads() UploadStore {
+	if svc.uploadStore == nil {
+		return defaultUploadStore
 	}
+	return svc.uploadStore
+}
 
-	log.Error(err)
+// Returns the hardware from the edited hardware to prevent unecessary calls to hardwareAdapter.
+// Reads it if not present yet. Failed reads are repeated by the next row looking up the hardware.
+func (svc *mappingService) editedHardware(ctx context.Context, lookups *importLookups, id string, edited *editedHardwareMap) (*editedCRUDobj, error) {
+	hardwareObj := edited.entry(id)
+
+	hardwareObj.load.Lock()
+	defer hardwareObj.load.Unlock()
+
+	if hardwareObj.hardwareCRUD != nil {
+		return hardwareObj, nil
+	}
+
+	readObj, err := lookups.hardware.ReadContext(ctx, id)
 	if err != nil {
-		return &Error{
-			ErrTitle: "Identifizierungs-Fehler",
-			ErrMsg:   fmt.Sprintf("Fehler in Zeile %d. Es konnten keine Hardware mit dem Identifikator '%s' ermittelt werden", row, identifierValue),
-		}
+		log.Error(err)
+		return nil, err
 	}
 
-	for _, listResult := range hardwareLookupList {
-		var hardwareObj *editedCRUDobj
+	original, err := flatten(readObj)
+	if err != nil {
+		log.Error(err)
+	}
 
-		// Check if hardwareCRUD already in editedCRUDmap to prevent unecessary calls to hardwareAdapter
-		// Insert into editedCRUDmap if not present
-		if _, ok := editedCRUDmap[listResult.Id]; !ok {
-			readObj, err := svc.hardwareAdapter.Read(listResult.Id)
-			if err != nil {
-				return &Error{
-					ErrTitle: "Identifizierungs-Fehler",
-					ErrMsg:   fmt.Sprintf("Fehler in Zeile %d. Es konnten keine Hardware mit dem Identifikator '%s' ermittelt werden", row, identifierValue),
-				}
-			}
+	before, err := crud.Clone(readObj)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 
-			hardwareObj = &editedCRUDobj{readObj, false}
-			// add editedCRUDobj to editedCRUDmap if not present
-			editedCRUDmap[listResult.Id] = hardwareObj
-		} else {
-			hardwareObj = editedCRUDmap[listResult.Id]
-		}
+	hardwareObj.hardwareCRUD, hardwareObj.original, hardwareObj.snapshot = readObj, original, before
+	return hardwareObj, nil
+}
 
-		for _, inst := range mi.Mapping {
-			coords, err := excelize.CoordinatesToCellName(inst.ColIndex, row)
-			if err != nil {
-				hardwareObj.hasError = true
-				return &Error{
-					ErrTitle: "Koordinatenfehler",
-					ErrMsg:   fmt.Sprintf("Fehler in Zeile %d, Spalte %d. Es die dazugehörige Excel-Koordinate konnte nicht konvertiert werden", row, inst.ColIndex),
-				}
-			}
-			cellVal, err := file.GetCellValue(sh, coords)
-			if err != nil {
-				hardwareObj.hasError = true
-				return &Error{
-					ErrTitle: "Lesefehler",
-					ErrMsg:   fmt.Sprintf("Wert der Zelle %s konnte nicht ausgelesen werden", coords),
-				}
-			}
+// Hardware edited by the rows of an import, keyed by id. Safe for concurrent lookups by the workers of the rowPool.
+type editedHardwareMap struct {
+	mu   sync.Mutex
+	objs map[string]*editedCRUDobj
+}
 
-			switch inst.MappingValue {
-			case "manufactWkz":
-				hardwareObj.hardwareCRUD.Wkz = writeOptionArr(hardwareObj.hardwareCRUD.Wkz, "manufacturer", cellVal)
-			case "ek24Wkz":
-				hardwareObj.hardwareCRUD.Wkz = writeOptionArr(hardwareObj.hardwareCRUD.Wkz, "ek24", cellVal)
-			case "price":
-				switch idType {
-				case "ebootisId":
-					if variant, ok := hardwareObj.hardwareCRUD.Variant(identifierValue); ok {
-						variant.Price, _ = getPeriodFloat(cellVal)
-						continue
-					}
-					hardwareObj.hasError = true
-					return &Error{
-						ErrTitle: "Variante unbekannt",
-						ErrMsg:   fmt.Sprintf("Es konnte keine Variante mit der Ebootis-ID %s gefunden werden", cellVal),
-					}
-				case "externalArticleNumber":
-					if variant, ok := hardwareObj.hardwareCRUD.VariantViaArticleNo(idType); ok { // added method from project
-						variant.Price, _ = getPeriodFloat(cellVal)
-						continue
-					}
-					hardwareObj.hasError = true
-					return &Error{
-						ErrTitle: "Variante unbekannt",
-						ErrMsg:   fmt.Sprintf("Es konnte keine Variante mit der MSD Artikelnummer %s gefunden werden", cellVal),
-					}
-				}
-			}
+func newEditedHardwareMap() *editedHardwareMap {
+	return &editedHardwareMap{objs: make(map[string]*editedCRUDobj)}
+}
 
+// Returns the entry of the hardware, creating an empty one if not present
+func (m *editedHardwareMap) entry(id string) *editedCRUDobj {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hardwareObj, ok := m.objs[id]
+	if !ok {
+		hardwareObj = &editedCRUDobj{}
+		m.objs[id] = hardwareObj
+	}
+	return hardwareObj
+}
+
+// Returns the hardware edited by at least one row, ordered by the first row that edited it
+func (m *editedHardwareMap) list() []*editedCRUDobj {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]*editedCRUDobj, 0, len(m.objs))
+	for _, hardwareObj := range m.objs {
+		if hardwareObj.hardwareCRUD != nil && len(hardwareObj.rows) > 0 {
+			result = append(result, hardwareObj)
 		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].rows[0] < result[j].rows[0]
+	})
+	return result
+}
 
+// Resolves the variant identified by the row. Marks the hardware as erroneous if it can't be found,
+// so it won't be written into db.
+func findVariant(hardwareObj *editedCRUDobj, identifierValue string, idType string) (*hardware.VariantCRUD, *Error) {
+	var variant *hardware.VariantCRUD
+	var ok bool
+
+	switch idType {
+	case "ebootisId":
+		variant, ok = hardwareObj.hardwareCRUD.Variant(identifierValue)
+	default:
+		variant, ok = hardwareObj.hardwareCRUD.VariantViaArticleNo(identifierValue)
 	}
-	return nil
+	if ok {
+		return variant, nil
+	}
+
+	hardwareObj.hasError = true
+	return nil, newError(Error{
+		Code:     ErrCodeIdentifierNotFound,
+		Field:    idType,
+		RawValue: identifierValue,
+		EntityId: hardwareObj.hardwareCRUD.Id,
+	})
 }
 
 func writeOptionArr(arr []*product.Option, key string, cellVal string) []*product.Option {
@@ -520,6 +1041,16 @@ func writeOptionArr(arr []*product.Option, key string, cellVal string) []*produc
 	return arr
 }
 
-func getPeriodFloat(s string) (float64, error) {
-	return strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+func removeOption(arr []*product.Option, key string) []*product.Option {
+	result := arr[:0]
+	for _, o := range arr {
+		if o.Key != key {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+func errCancelled() *Error {
+	return newError(Error{Code: ErrCodeCancelled})
 }
@@ -2,14 +2,20 @@ package dataimport
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/product"
 	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
 	"github.com/Filipza/excel-mapping-tool/internal/settings"
 	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
 )
 
 func TestCustomError(t *testing.T) {
@@ -54,12 +60,17 @@ func TestDirCreationPositive(t *testing.T) {
 		Uuid:         "3fc7522d-ed25-40df-9972-333ba8aea504",
 	}
 
+	// The fixed uuid is rejected while the upload of an earlier run is still stored
+	uploadDir := filepath.Join(os.TempDir(), mockUploadData.Uuid)
+	os.RemoveAll(uploadDir)
+	t.Cleanup(func() { os.RemoveAll(uploadDir) })
+
 	svc := mappingService{}
 
 	_, err = svc.ReadFile(mockUploadData)
 
 	assert.NoError(t, err, "valid UUID should be accepted for directory creation")
-	assert.FileExists(t, "/tmp/"+mockUploadData.Uuid+"/data.xlsx")
+	assert.FileExists(t, filepath.Join(os.TempDir(), mockUploadData.Uuid, "data.xlsx"))
 }
 
 func TestDirCreationNegative(t *testing.T) {
@@ -115,6 +126,7 @@ func TestReadFileEmpty(t *testing.T) {
 
 	if customErr, ok := err.(*Error); ok {
 		assert.Equal(t, "Parsingfehler", customErr.ErrTitle)
+		assert.Equal(t, ErrCodeFileParseFailed, customErr.Code)
 	}
 }
 
@@ -127,6 +139,7 @@ func TestReadFileEmptyHeaders(t *testing.T) {
 	mockUploadData := &UploadData{
 		UploadedFile: bytes.NewReader(file),
 		UploadType:   "stocks",
+		HeaderRow:    1,
 	}
 
 	svc := mappingService{}
@@ -135,11 +148,129 @@ func TestReadFileEmptyHeaders(t *testing.T) {
 
 	if customErr, ok := err.(*Error); ok {
 		assert.Equal(t, customErr.ErrTitle, "Leerzeile")
+		assert.Equal(t, ErrCodeHeaderRowEmpty, customErr.Code)
 	}
 
 	assert.Error(t, err)
 }
 
+func TestReadFileDetectHeaderRow(t *testing.T) {
+	file, err := os.ReadFile("../../../test/empty_headers.xlsx")
+	if err != nil {
+		t.Fatalf("loading test .xlsx failed: %v", err)
+	}
+
+	svc := mappingService{}
+
+	result, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+	})
+
+	assert.NoError(t, err, "blank rows above the headers should be skipped")
+	assert.Equal(t, 2, result.HeaderRow)
+	assert.Equal(t, []string{"ArtNr", "Artikel-Bezeichnung", "WKZ", "gültig bis"}, result.TableHeaders)
+	assert.Equal(t, []string{"31161", "IPHONE 12 64GB", "9.76 €"}, result.TableSummary[0])
+}
+
+func TestDetectHeaderRow(t *testing.T) {
+	tests := []struct {
+		name string
+		top  [][]string
+		want int
+	}{
+		{"first row", [][]string{{"ArtNr", "EK"}, {"1", "2"}}, 1},
+		{"blank rows above", [][]string{{}, {}, {"ArtNr", "EK"}, {"1", "2"}}, 3},
+		{"title and logo above", [][]string{{"Preisliste KW 42"}, {"", "Stand: 01.10."}, {"ArtNr", "Bezeichnung", "EK"}, {"1", "iPhone", "799"}}, 3},
+		{"numeric rows only", [][]string{{}, {"1", "2"}, {"3", "4"}}, 2},
+		{"single column", [][]string{{"EbootisId"}, {"100"}}, 1},
+		{"empty", [][]string{}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectHeaderRow(tt.top))
+		})
+	}
+}
+
+func TestDataRange(t *testing.T) {
+	first, last, err := (&MappingInstruction{}).DataRange()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 0, last)
+
+	first, last, err = (&MappingInstruction{HeaderRow: 3, LastDataRow: 10}).DataRange()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, first)
+	assert.Equal(t, 10, last)
+
+	_, _, err = (&MappingInstruction{HeaderRow: 3, FirstDataRow: 2}).DataRange()
+	assert.NotNil(t, err, "data rows above the header row should be rejected")
+
+	_, _, err = (&MappingInstruction{FirstDataRow: 5, LastDataRow: 4}).DataRange()
+	assert.NotNil(t, err, "last data row above the first one should be rejected")
+}
+
+func TestWriteMappingDataRange(t *testing.T) {
+	file := newTestWorkbook(t, [][]string{
+		{"Lieferant Mustermann GmbH"},
+		{},
+		{"ArtNr", "Bestand"},
+		{"31161", "12"},
+		{"37803", "3"},
+		{},
+		{"Summe", "15"},
+	})
+
+	hw := &hardware.HardwareCRUD{
+		Id: "hw1",
+		Variants: []*hardware.VariantCRUD{
+			{EbootisId: "1000-1", ExternalArticleNumber: "31161"},
+			{EbootisId: "1000-2", ExternalArticleNumber: "37803"},
+		},
+	}
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return hw, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	assert.Equal(t, 3, options.HeaderRow)
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType:     "stocks",
+		HeaderRow:      options.HeaderRow,
+		StopAtEmptyRow: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.SuccessfulRows)
+	assert.Equal(t, 0, result.UnsuccessfulRows, "rows below the first empty row should not be imported")
+	assert.Equal(t, intPtr(12), hw.Variants[0].Stock)
+	assert.Equal(t, intPtr(3), hw.Variants[1].Stock)
+}
+
 func TestReadFileNoUploadType(t *testing.T) {
 	file, err := os.ReadFile("../../../test/positive.xlsx")
 	if err != nil {
@@ -394,3 +525,930 @@ func TestWriteMapping(t *testing.T) {
 
 	// }
 }
+
+func TestWriteMappingStocks(t *testing.T) {
+	file := newTestWorkbook(t, [][]string{
+		{"ArtNr", "Bestand", "Bestand original"},
+		{"31161", "12", "20"},
+		{"37803", "3", "5"},
+	})
+
+	hw := &hardware.HardwareCRUD{
+		Id: "hw1",
+		Variants: []*hardware.VariantCRUD{
+			{EbootisId: "1000-1", ExternalArticleNumber: "31161"},
+			{EbootisId: "1000-2", ExternalArticleNumber: "37803"},
+		},
+	}
+
+	updates := 0
+	hardwareAdapter := &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+		list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+			return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+		},
+		read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+			return hw, nil
+		},
+		update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+			updates++
+			return h, nil
+		},
+	}
+	svc := &mappingService{
+		hardwareAdapter: hardwareAdapter,
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+			{ColIndex: 3, MappingValue: "originalStock"},
+		},
+		UploadType: "stocks",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.SuccessfulRows)
+	assert.Equal(t, 1, updates, "hardware should be written once for all of its variants")
+	assert.Equal(t, intPtr(12), hw.Variants[0].Stock)
+	assert.Equal(t, intPtr(20), hw.Variants[0].OriginalStock)
+	assert.Equal(t, intPtr(3), hw.Variants[1].Stock)
+	assert.Equal(t, intPtr(5), hw.Variants[1].OriginalStock)
+}
+
+func TestWriteMappingPricesWithoutStock(t *testing.T) {
+	file := newTestWorkbook(t, [][]string{
+		{"ArtNr", "EK"},
+		{"31161", "499,99"},
+	})
+
+	var written []byte
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return &hardware.HardwareCRUD{
+					Id:       "hw1",
+					Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161"}},
+				}, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				written, _ = json.Marshal(h)
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(file), UploadType: "hardware"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "price"},
+		},
+		UploadType: "hardware",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.SuccessfulRows)
+	assert.Contains(t, string(written), `"price":499.99`)
+	assert.NotContains(t, string(written), "stock", "stocks unknown to the import are left to the backend")
+	assert.NotContains(t, string(written), "originalStock")
+}
+
+func TestWriteMappingDryRun(t *testing.T) {
+	file := newTestWorkbook(t, [][]string{
+		{"ArtNr", "Bestand"},
+		{"31161", "12"},
+	})
+
+	hardwareAdapter := &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+		list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+			return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+		},
+		read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+			return &hardware.HardwareCRUD{
+				Id:       "hw1",
+				Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161", Stock: intPtr(4)}},
+			}, nil
+		},
+	}
+	svc := &mappingService{
+		hardwareAdapter: hardwareAdapter,
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+		DryRun:     true,
+	})
+
+	assert.NoError(t, err, "dry run must not call Update")
+	assert.Equal(t, []EntityChange{{
+		EntityType: "hardware",
+		EntityId:   "hw1",
+		Fields:     []FieldChange{{Field: "variants[0].stock", OldValue: 4.0, NewValue: 12.0}},
+	}}, result.Changes)
+	assert.FileExists(t, filepath.Join(os.TempDir(), options.Uuid, "data.xlsx"), "upload should be kept after a dry run")
+}
+
+func TestWriteMappingDryRunTariffChanges(t *testing.T) {
+	file := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr", "Anschlussgebühr"},
+		{"T-1", "9,99", ""},
+		{"T-1", "", "39,99"},
+		{"T-2", "19,99", ""},
+	})
+
+	svc := &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].StringValue()}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s, EbootisId: s}, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(file), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+			{ColIndex: 3, MappingValue: "connectionFee"},
+		},
+		UploadType: "tariff",
+		DryRun:     true,
+	})
+
+	assert.NoError(t, err, "dry run must not call Update")
+	// Both rows of T-1 end up in a single change
+	if assert.Len(t, result.Changes, 2) {
+		assert.Equal(t, "T-1", result.Changes[0].EntityId)
+		assert.Contains(t, result.Changes[0].Fields, FieldChange{Field: "basicCharge", OldValue: 0.0, NewValue: 9.99})
+		assert.Contains(t, result.Changes[0].Fields, FieldChange{Field: "connectionFee", OldValue: 0.0, NewValue: 39.99})
+		assert.Equal(t, "T-2", result.Changes[1].EntityId)
+	}
+}
+
+func newTestWorkbook(t testing.TB, rows [][]string) []byte {
+	t.Helper()
+
+	sheet := excelize.NewFile()
+	defer sheet.Close()
+
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := sheet.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatalf("Creating test .xlsx failed: %v", err)
+		}
+	}
+
+	buf, err := sheet.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("Creating test .xlsx failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestWriteMappingErrorContext(t *testing.T) {
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				if o[0].Value == "40000" {
+					return nil, errors.New("backend unavailable")
+				}
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return &hardware.HardwareCRUD{
+					Id:       "hw1",
+					Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161"}},
+				}, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(newTestWorkbook(t, [][]string{
+			{"ArtNr", "Bestand"},
+			{"99999", "3"},
+			{"40000", "5"},
+		})),
+		UploadType: "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+	})
+	assert.NoError(t, err)
+	if !assert.Len(t, result.FailedRows, 2) {
+		return
+	}
+
+	notFound := result.FailedRows[0]
+	assert.Equal(t, ErrCodeIdentifierNotFound, notFound.Code)
+	assert.Equal(t, 2, notFound.Row)
+	assert.Equal(t, 1, notFound.Column)
+	assert.Equal(t, "A2", notFound.CellRef)
+	assert.Equal(t, "externalArticleNumber", notFound.Field)
+	assert.Equal(t, "99999", notFound.RawValue)
+	assert.Equal(t, "hw1", notFound.EntityId)
+
+	lookup := result.FailedRows[1]
+	assert.Equal(t, ErrCodeLookupFailed, lookup.Code)
+	assert.Equal(t, 3, lookup.Row)
+	assert.Equal(t, "A3", lookup.CellRef)
+	assert.Empty(t, lookup.EntityId)
+
+	data, err := json.Marshal(lookup)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"code": "LOOKUP_FAILED",
+		"errTitle": "Identifizierungs-Fehler",
+		"errMsg": "Fehler in Zeile 3. Zum Identifikator '40000' konnten keine Daten ermittelt werden.",
+		"row": 3,
+		"column": 1,
+		"cellRef": "A3",
+		"field": "externalArticleNumber",
+		"rawValue": "40000"
+	}`, string(data))
+}
+
+func TestWriteMappingStrictParsing(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr", "Lead Type", "Rechtstext"},
+		{"T-1", "n/a", "3", "Neu"},
+		{"T-2", "", "x", "Neu"},
+	})
+
+	for _, skip := range []bool{false, true} {
+		updated := make(map[string]*tariff.TariffCRUD)
+		svc := &mappingService{
+			tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+				list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+					return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+				},
+				read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					return &tariff.TariffCRUD{Id: s, BasicCharge: 19.99, LeadType: 1}, nil
+				},
+				update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+					updated[s] = tc
+					return tc, nil
+				},
+			},
+		}
+
+		options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		result, err := svc.WriteMapping(&MappingInstruction{
+			Uuid: options.Uuid,
+			Mapping: []MappingObject{
+				{ColIndex: 1, MappingValue: "ebootisId"},
+				{ColIndex: 2, MappingValue: "basicCharge"},
+				{ColIndex: 3, MappingValue: "leadType"},
+				{ColIndex: 4, MappingValue: "legalNote"},
+			},
+			UploadType:        "tariff",
+			SkipInvalidFields: skip,
+		})
+		assert.NoError(t, err)
+
+		if !skip {
+			assert.Equal(t, 2, result.UnsuccessfulRows)
+			assert.Empty(t, updated, "rows with invalid cells must not be written")
+			if assert.Len(t, result.FailedRows, 2) {
+				assert.Equal(t, ErrCodeCellParseFailed, result.FailedRows[0].Code)
+				assert.Equal(t, "B2", result.FailedRows[0].CellRef)
+				assert.Equal(t, "basicCharge", result.FailedRows[0].Field)
+				assert.Equal(t, "n/a", result.FailedRows[0].RawValue)
+				assert.Equal(t, "C3", result.FailedRows[1].CellRef)
+			}
+			continue
+		}
+
+		assert.Equal(t, 2, result.SuccessfulRows)
+		assert.Len(t, result.SkippedFields, 2)
+		if assert.Len(t, updated, 2) {
+			assert.Equal(t, 19.99, updated["T-1"].BasicCharge, "invalid price is skipped")
+			assert.Equal(t, 3, updated["T-1"].LeadType)
+			assert.Equal(t, 19.99, updated["T-2"].BasicCharge, "empty price keeps the current one")
+			assert.Equal(t, 1, updated["T-2"].LeadType)
+			assert.Equal(t, "Neu", updated["T-2"].LegalNote)
+		}
+	}
+}
+
+func TestWriteMappingEmptyCells(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr", "Rechtstext", "Benefit 1", "Pib"},
+		{"T-1", "", "", "", ""},
+	})
+
+	read := func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+		return &tariff.TariffCRUD{
+			Id:          s,
+			BasicCharge: 19.99,
+			LegalNote:   "Hinweis",
+			PibLink:     "https://example.com/pib.pdf",
+			Bullets:     []*product.Option{{Key: "tariff_inclusive_benefit1", Value: "Benefit"}},
+		}, nil
+	}
+
+	tests := []struct {
+		name     string
+		mapping  []MappingObject
+		expected func(t *testing.T, result *MappingResult, updated *tariff.TariffCRUD)
+	}{
+		{
+			name: "defaults",
+			mapping: []MappingObject{
+				{ColIndex: 2, MappingValue: "basicCharge"},
+				{ColIndex: 3, MappingValue: "legalNote"},
+				{ColIndex: 4, MappingValue: "bullet1"},
+			},
+			expected: func(t *testing.T, result *MappingResult, updated *tariff.TariffCRUD) {
+				assert.Equal(t, 19.99, updated.BasicCharge)
+				assert.Equal(t, "", updated.LegalNote)
+				assert.Empty(t, updated.Bullets, "empty bullets are removed instead of written")
+			},
+		},
+		{
+			name: "keep and clear",
+			mapping: []MappingObject{
+				{ColIndex: 2, MappingValue: "basicCharge", EmptyCells: EmptyCellsClear},
+				{ColIndex: 3, MappingValue: "legalNote", EmptyCells: EmptyCellsKeep},
+				{ColIndex: 4, MappingValue: "bullet1", EmptyCells: EmptyCellsKeep},
+				{ColIndex: 5, MappingValue: "pibLink", EmptyCells: EmptyCellsKeep},
+			},
+			expected: func(t *testing.T, result *MappingResult, updated *tariff.TariffCRUD) {
+				assert.Equal(t, 0.0, updated.BasicCharge)
+				assert.Equal(t, "Hinweis", updated.LegalNote)
+				assert.Equal(t, "https://example.com/pib.pdf", updated.PibLink)
+				assert.Len(t, updated.Bullets, 1)
+			},
+		},
+		{
+			name: "error",
+			mapping: []MappingObject{
+				{ColIndex: 2, MappingValue: "basicCharge", EmptyCells: EmptyCellsError},
+				{ColIndex: 3, MappingValue: "legalNote"},
+			},
+			expected: func(t *testing.T, result *MappingResult, updated *tariff.TariffCRUD) {
+				assert.Nil(t, updated)
+				if assert.Len(t, result.FailedRows, 1) {
+					assert.Equal(t, ErrCodeCellEmpty, result.FailedRows[0].Code)
+					assert.Equal(t, "B2", result.FailedRows[0].CellRef)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *tariff.TariffCRUD
+			svc := &mappingService{
+				tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+					list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+						return []*tariff.TariffLookup{{Id: "T-1"}}, nil
+					},
+					read: read,
+					update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+						updated = tc
+						return tc, nil
+					},
+				},
+			}
+
+			options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+
+			result, err := svc.WriteMapping(&MappingInstruction{
+				Uuid:       options.Uuid,
+				Mapping:    append([]MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}}, tt.mapping...),
+				UploadType: "tariff",
+			})
+			if assert.NoError(t, err) {
+				tt.expected(t, result, updated)
+			}
+		})
+	}
+
+	_, err := (&mappingService{}).WriteMapping(&MappingInstruction{
+		Uuid:       "0e4f5a7c-8d1b-4c2e-b3a6-9f8e7d6c5b4a",
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "ebootisId", EmptyCells: "ignore"}},
+		UploadType: "tariff",
+	})
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeEmptyCellsUnknown, importErr.Code)
+	}
+}
+
+func TestWriteMappingEmptyIdentifier(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Legalnote"},
+		{"", "Hinweis"},
+		{"T-1", "Hinweis"},
+	})
+
+	var listed []string
+	svc := &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				listed = append(listed, o[0].StringValue())
+				return []*tariff.TariffLookup{{Id: "T-1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// Neither clearing the identifier nor skipping invalid fields lets the row through
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId", EmptyCells: EmptyCellsClear},
+			{ColIndex: 2, MappingValue: "legalNote"},
+		},
+		UploadType:        "tariff",
+		SkipInvalidFields: true,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"T-1"}, listed, "rows without identifier aren't looked up")
+	assert.Equal(t, 1, result.SuccessfulRows)
+	assert.Equal(t, 1, result.UnsuccessfulRows)
+	if assert.Len(t, result.FailedRows, 1) {
+		assert.Equal(t, ErrCodeCellEmpty, result.FailedRows[0].Code)
+		assert.Equal(t, "A2", result.FailedRows[0].CellRef)
+		assert.Equal(t, "ebootisId", result.FailedRows[0].Field)
+	}
+}
+
+func TestWriteMappingUploadNotFound(t *testing.T) {
+	svc := &mappingService{}
+
+	_, err := svc.WriteMapping(&MappingInstruction{
+		Uuid:       "9d6f0c4e-3b8e-4a53-a4f5-8f1a2c6d7e90",
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}},
+		UploadType: "stocks",
+	})
+
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeUploadNotFound, importErr.Code)
+	}
+}
+
+func TestReadFileMultiSheet(t *testing.T) {
+	file, err := os.ReadFile("../../../test/multi_sheet.xlsx")
+	if err != nil {
+		t.Fatalf("Loading test .xlsx failed: %v", err)
+	}
+
+	svc := mappingService{}
+
+	result, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+		Sheet:        "Bestand",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Bestand", result.Sheet)
+	assert.Equal(t, []string{"ArtNr", "Bezeichnung", "Bestand", "Bestand original"}, result.TableHeaders)
+	if assert.Len(t, result.Sheets, 2) {
+		assert.Equal(t, SheetPreview{Name: "Deckblatt", Rows: [][]string{{"Lieferant Mustermann GmbH"}, {"Preisliste KW 42"}}}, result.Sheets[0])
+		assert.Equal(t, "Bestand", result.Sheets[1].Name)
+		assert.Len(t, result.Sheets[1].Rows, 3)
+	}
+
+	_, err = svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+		Sheet:        "Tabelle3",
+	})
+
+	if customErr, ok := err.(*Error); assert.True(t, ok, "unknown sheet should be rejected") {
+		assert.Equal(t, "Arbeitsblatt unbekannt", customErr.ErrTitle)
+	}
+}
+
+func TestWriteMappingSheetSelection(t *testing.T) {
+	file, err := os.ReadFile("../../../test/multi_sheet.xlsx")
+	if err != nil {
+		t.Fatalf("Loading test .xlsx failed: %v", err)
+	}
+
+	hw := &hardware.HardwareCRUD{
+		Id: "hw1",
+		Variants: []*hardware.VariantCRUD{
+			{EbootisId: "1000-1", ExternalArticleNumber: "31161"},
+			{EbootisId: "1000-2", ExternalArticleNumber: "37803"},
+		},
+	}
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return hw, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	assert.Equal(t, "Deckblatt", options.Sheet, "first sheet should be the default")
+
+	mi := &MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 3, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+		Sheet:      "Preise",
+		DryRun:     true,
+	}
+
+	_, err = svc.WriteMapping(mi)
+	assert.Error(t, err, "unknown sheet should be rejected")
+
+	mi.Sheet = "Bestand"
+	mi.DryRun = false
+	result, err := svc.WriteMapping(mi)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.SuccessfulRows)
+	assert.Equal(t, intPtr(12), hw.Variants[0].Stock)
+	assert.Equal(t, intPtr(3), hw.Variants[1].Stock)
+}
+
+func TestWriteMappingTransactional(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr"},
+		{"T-1", "29,99"},
+		{"T-2", "39,99"},
+		{"T-3", "49,99"},
+		{"T-4", "59,99"},
+	})
+
+	tests := []struct {
+		name          string
+		maxFailedRows int
+		restoreFails  bool
+		rolledBack    bool
+	}{
+		{name: "first failure rolls back", rolledBack: true},
+		{name: "failure within threshold", maxFailedRows: 1},
+		{name: "failed restore", rolledBack: true, restoreFails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := map[string]float64{"T-1": 9.99, "T-2": 9.99, "T-3": 9.99, "T-4": 9.99}
+			svc := &mappingService{
+				tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+					list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+						return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+					},
+					read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+						return &tariff.TariffCRUD{Id: s, BasicCharge: stored[s]}, nil
+					},
+					update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+						if s == "T-3" || (tt.restoreFails && s == "T-1" && tc.BasicCharge == 9.99) {
+							return nil, errors.New("update failed")
+						}
+						stored[s] = tc.BasicCharge
+						return tc, nil
+					},
+				},
+			}
+
+			options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+
+			result, err := svc.WriteMapping(&MappingInstruction{
+				Uuid: options.Uuid,
+				Mapping: []MappingObject{
+					{ColIndex: 1, MappingValue: "ebootisId"},
+					{ColIndex: 2, MappingValue: "basicCharge"},
+				},
+				UploadType:    "tariff",
+				Transactional: true,
+				MaxFailedRows: tt.maxFailedRows,
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.rolledBack, result.RolledBack)
+			assert.Equal(t, 1, result.UnsuccessfulRows)
+
+			if !tt.rolledBack {
+				assert.Equal(t, 3, result.SuccessfulRows)
+				assert.Empty(t, result.Reverted)
+				assert.Equal(t, map[string]float64{"T-1": 29.99, "T-2": 39.99, "T-3": 9.99, "T-4": 59.99}, stored)
+				return
+			}
+
+			assert.Equal(t, 2, result.SuccessfulRows, "rows after the failure are not imported")
+			assert.Equal(t, 9.99, stored["T-2"])
+			assert.Equal(t, 9.99, stored["T-4"], "rows after the failure are not imported")
+			if assert.NotEmpty(t, result.Reverted) {
+				assert.Equal(t, "T-2", result.Reverted[0].EntityId, "entities are restored in reverse order")
+				assert.Contains(t, result.Reverted[0].Fields, FieldChange{Field: "basicCharge", OldValue: 9.99, NewValue: 39.99})
+			}
+
+			if tt.restoreFails {
+				assert.Len(t, result.Reverted, 1)
+				assert.Equal(t, 29.99, stored["T-1"])
+				if assert.Len(t, result.RollbackFailures, 1) {
+					assert.Equal(t, ErrCodeRollbackFailed, result.RollbackFailures[0].Code)
+					assert.Equal(t, "T-1", result.RollbackFailures[0].EntityId)
+				}
+				return
+			}
+
+			assert.Len(t, result.Reverted, 2)
+			assert.Empty(t, result.RollbackFailures)
+			assert.Equal(t, 9.99, stored["T-1"])
+		})
+	}
+}
+
+func TestWriteMappingTransactionalHardware(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Bestand"},
+		{"1000-1", "12"},
+		{"1000-9", "3"},
+	})
+
+	hw := &hardware.HardwareCRUD{
+		Id:       "hw1",
+		Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", Stock: intPtr(5)}},
+	}
+	updates := 0
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return hw, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				updates++
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "stocks"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType:    "stocks",
+		Transactional: true,
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, result.RolledBack)
+	assert.Zero(t, updates, "hardware is not written once the import is rolled back")
+	assert.Empty(t, result.Reverted)
+}
+
+func TestWriteMappingIdentifierColumn(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"Grundgebühr", "EbootisId"},
+		{"9,99", "T-1"},
+	})
+
+	var updated *tariff.TariffCRUD
+	svc := &mappingService{
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				updated = tc
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// The identifier is read from its mapped column, not from the column at its position in the mapping
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "basicCharge"},
+			{ColIndex: 2, MappingValue: "ebootisId"},
+		},
+		UploadType: "tariff",
+	})
+	if assert.NoError(t, err) && assert.Equal(t, 1, result.SuccessfulRows) {
+		assert.Equal(t, "T-1", updated.Id)
+		assert.Equal(t, 9.99, updated.BasicCharge)
+	}
+}
+
+// Tariff upload with the given number of data rows, 5 mapped columns each
+func newBenchmarkWorkbook(b *testing.B, rowCount int) []byte {
+	rows := [][]string{{"EbootisId", "Grundgebühr", "Anschlussgebühr", "Provision", "Name"}}
+	for i := 0; i < rowCount; i++ {
+		rows = append(rows, []string{fmt.Sprintf("T-%d", i), "9,99", "39,99", fmt.Sprint(i), "Tarif"})
+	}
+	return newTestWorkbook(b, rows)
+}
+
+var benchmarkMapping = []MappingObject{
+	{ColIndex: 1, MappingValue: "ebootisId"},
+	{ColIndex: 2, MappingValue: "basicCharge"},
+	{ColIndex: 3, MappingValue: "connectionFee"},
+	{ColIndex: 4, MappingValue: "provision"},
+}
+
+// Compares reading the mapped cells from the columns of each row, as WriteMapping does, with looking up every
+// mapped cell by its name
+func BenchmarkReadRows(b *testing.B) {
+	file, err := excelize.OpenReader(bytes.NewReader(newBenchmarkWorkbook(b, 20000)))
+	if err != nil {
+		b.Fatalf("Opening benchmark .xlsx failed: %v", err)
+	}
+	defer file.Close()
+
+	mi := &MappingInstruction{Mapping: benchmarkMapping, UploadType: "tariff"}
+	fields := uploadTypeFields[mi.UploadType]
+
+	b.Run("columns", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := file.Rows("Sheet1")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for row := 1; rows.Next(); row++ {
+				cols, err := rows.Columns()
+				if err != nil {
+					b.Fatal(err)
+				}
+				readRow(fields, mi, cols, nil, row)
+			}
+			rows.Close()
+		}
+	})
+
+	b.Run("cell lookup", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := file.Rows("Sheet1")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for row := 1; rows.Next(); row++ {
+				cols := make([]string, 0, len(mi.Mapping))
+				for _, inst := range mi.Mapping {
+					cell, err := excelize.CoordinatesToCellName(inst.ColIndex, row)
+					if err != nil {
+						b.Fatal(err)
+					}
+					val, err := file.GetCellValue("Sheet1", cell)
+					if err != nil {
+						b.Fatal(err)
+					}
+					cols = append(cols, val)
+				}
+				readRow(fields, mi, cols, nil, row)
+			}
+			rows.Close()
+		}
+	})
+}
+
+func BenchmarkWriteMapping(b *testing.B) {
+	upload := newBenchmarkWorkbook(b, 20000)
+	svc := &mappingService{
+		uploadStore: NewMemoryUploadStore(),
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		b.Fatalf("ReadFile failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := svc.WriteMapping(&MappingInstruction{
+			Uuid:       options.Uuid,
+			Mapping:    benchmarkMapping,
+			UploadType: "tariff",
+			DryRun:     true,
+		})
+		if err != nil || result.SuccessfulRows != 20000 {
+			b.Fatalf("WriteMapping failed: %v", err)
+		}
+	}
+}
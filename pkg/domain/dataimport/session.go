@@ -0,0 +1,267 @@
+package dataimport
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Time an upload session is kept, unless configured via WithSessionTTL
+const defaultSessionTTL = 30 * time.Minute
+
+// Time the metadata of an expired session is kept after its files were removed, so late requests are answered
+// with SESSION_EXPIRED instead of UPLOAD_NOT_FOUND. Also bounds the lifetime of uploads in the UploadStore in case
+// no sweeper runs.
+const expiredSessionRetention = 24 * time.Hour
+
+// Name of the file holding the session metadata among the files of the upload
+const sessionFileName = "session.json"
+
+// Metadata of an upload, stored along with its files so it outlives restarts and is shared by all instances
+// using the same UploadStore
+type uploadSession struct {
+	Uuid       string    `json:"uuid"`
+	UploadType string    `json:"uploadType"`
+	Owner      string    `json:"owner,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	// Set by the sweeper once the files of the upload are removed
+	Swept bool `json:"swept,omitempty"`
+	// Set once the upload was imported. Only the error report of the import is kept, see consumeSession.
+	Imported bool `json:"imported,omitempty"`
+}
+
+func (session *uploadSession) expired() bool {
+	return time.Now().After(session.Expires)
+}
+
+// Uploads in use by an import of this instance, which the sweeper must not remove even if their session expired
+type activeSessions struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (active *activeSessions) acquire(uploadUuid string) {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	if active.count == nil {
+		active.count = make(map[string]int)
+	}
+	active.count[uploadUuid]++
+}
+
+// Acquires the upload unless it is in use already
+func (active *activeSessions) tryAcquire(uploadUuid string) bool {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	if active.count[uploadUuid] > 0 {
+		return false
+	}
+	if active.count == nil {
+		active.count = make(map[string]int)
+	}
+	active.count[uploadUuid]++
+	return true
+}
+
+func (active *activeSessions) release(uploadUuid string) {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	if active.count[uploadUuid]--; active.count[uploadUuid] <= 0 {
+		delete(active.count, uploadUuid)
+	}
+}
+
+// Runs remove unless the upload is in use. Uploads can't be acquired meanwhile, so an import either keeps the
+// sweeper away or finds the upload removed once it acquired it.
+func (active *activeSessions) removeUnlessActive(uploadUuid string, remove func() bool) bool {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	if active.count[uploadUuid] > 0 {
+		return false
+	}
+	return remove()
+}
+
+func (svc *mappingService) ttl() time.Duration {
+	if svc.sessionTTL <= 0 {
+		return defaultSessionTTL
+	}
+	return svc.sessionTTL
+}
+
+// TTL of the files of a session in the UploadStore. Outlasts the session, so its expiry can still be told apart
+// from an unknown upload.
+func (svc *mappingService) retention() time.Duration {
+	return svc.ttl() + expiredSessionRetention
+}
+
+// Stores a new upload along with its session. Fails with UPLOAD_EXISTS if the uuid is in use, as long as its
+// session is kept, instead of replacing an upload that may be imported meanwhile.
+func (svc *mappingService) storeUpload(ud *UploadData, fileName string, data []byte) error {
+	// Keeps concurrent uploads with the same uuid of this instance from passing the check below at once
+	if !svc.activeSessions.tryAcquire(ud.Uuid) {
+		return newError(Error{Code: ErrCodeUploadExists, args: map[string]any{"uuid": ud.Uuid}})
+	}
+	defer svc.activeSessions.release(ud.Uuid)
+
+	_, err := svc.loadSession(ud.Uuid)
+	if err == nil {
+		return newError(Error{Code: ErrCodeUploadExists, args: map[string]any{"uuid": ud.Uuid}})
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Error(err)
+		return newError(Error{Code: ErrCodeStorageFailed})
+	}
+
+	if err := svc.openSession(ud); err != nil {
+		log.Error(err)
+		return newError(Error{Code: ErrCodeStorageFailed})
+	}
+	if err := svc.uploads().Put(ud.Uuid, fileName, data, svc.retention()); err != nil {
+		log.Error(err)
+		// Without its files the session would only block the uuid
+		if err := svc.uploads().Delete(ud.Uuid); err != nil {
+			log.Error(err)
+		}
+		return newError(Error{Code: ErrCodeStorageFailed})
+	}
+	return nil
+}
+
+// Starts the session of a new upload. Stored before the files of the upload, so the sweeper never finds an upload
+// without its session.
+func (svc *mappingService) openSession(ud *UploadData) error {
+	now := time.Now()
+	return svc.saveSession(&uploadSession{
+		Uuid:       ud.Uuid,
+		UploadType: ud.UploadType,
+		Owner:      ud.User,
+		Created:    now,
+		Expires:    now.Add(svc.ttl()),
+	})
+}
+
+func (svc *mappingService) saveSession(session *uploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return svc.uploads().Put(session.Uuid, sessionFileName, data, time.Until(session.Expires)+expiredSessionRetention)
+}
+
+// Returns the session of the upload. Fails with SESSION_EXPIRED once its TTL elapsed, even if the sweeper didn't
+// remove it yet.
+func (svc *mappingService) session(uploadUuid string) (*uploadSession, error) {
+	session, err := svc.loadSession(uploadUuid)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, newError(Error{Code: ErrCodeUploadNotFound, args: map[string]any{"uuid": uploadUuid}})
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{Code: ErrCodeStorageFailed})
+	}
+
+	if session.expired() {
+		return nil, newError(Error{Code: ErrCodeSessionExpired, args: map[string]any{"uuid": uploadUuid}})
+	}
+	if session.Imported {
+		return nil, newError(Error{Code: ErrCodeUploadImported, args: map[string]any{"uuid": uploadUuid}})
+	}
+	return session, nil
+}
+
+// Ends the session of an imported upload, keeping only the error report of the import for another TTL. The upload
+// itself is removed, so it can't be imported twice.
+func (svc *mappingService) consumeSession(session *uploadSession) error {
+	report, err := svc.uploads().Get(session.Uuid, reportFileName)
+	if err != nil {
+		return err
+	}
+
+	// Marked before the upload is removed, so it isn't imported again even if removing it fails
+	session.Imported = true
+	session.Expires = time.Now().Add(svc.ttl())
+	if err := svc.saveSession(session); err != nil {
+		return err
+	}
+
+	if err := svc.uploads().Delete(session.Uuid); err != nil {
+		return err
+	}
+	if err := svc.saveSession(session); err != nil {
+		return err
+	}
+	return svc.uploads().Put(session.Uuid, reportFileName, report, svc.retention())
+}
+
+// Removes the upload of the session along with all its files
+func (svc *mappingService) closeSession(uploadUuid string) {
+	if err := svc.uploads().Delete(uploadUuid); err != nil {
+		log.Error(err)
+	}
+}
+
+// Reads the session metadata regardless of its expiry
+func (svc *mappingService) loadSession(uploadUuid string) (*uploadSession, error) {
+	data, err := svc.uploads().Get(uploadUuid, sessionFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &uploadSession{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Removes the files of all uploads with an expired session, except those in use by an import of this instance.
+// Only the session metadata is kept, see expiredSessionRetention. Uploads without a readable session are left to
+// the expiry of the UploadStore. Returns the number of removed uploads.
+func (svc *mappingService) SweepSessions() (int, error) {
+	uploads, err := svc.uploads().List()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, uploadUuid := range uploads {
+		// Imports are only kept from acquiring uploads whose session is about to be removed
+		if session, err := svc.loadSession(uploadUuid); err != nil || session.Swept || !session.expired() {
+			continue
+		}
+		if svc.activeSessions.removeUnlessActive(uploadUuid, func() bool { return svc.sweepSession(uploadUuid) }) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Removes the files of the upload if its session expired and keeps the session as tombstone. Checks the session
+// again, it may have been renewed meanwhile. Reports whether the upload was removed.
+func (svc *mappingService) sweepSession(uploadUuid string) bool {
+	session, err := svc.loadSession(uploadUuid)
+	if err != nil || session.Swept || !session.expired() {
+		return false
+	}
+
+	if err := svc.uploads().Delete(uploadUuid); err != nil {
+		log.Error(err)
+		return false
+	}
+
+	session.Swept = true
+	data, err := json.Marshal(session)
+	if err == nil {
+		err = svc.uploads().Put(uploadUuid, sessionFileName, data, expiredSessionRetention)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package dataimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadSession(t *testing.T) {
+	store := NewMemoryUploadStore()
+	svc := &mappingService{uploadStore: store}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+		UploadType:   "stocks",
+		User:         "m.mustermann",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	session, err := svc.session(options.Uuid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "stocks", session.UploadType)
+		assert.Equal(t, "m.mustermann", session.Owner)
+		assert.WithinDuration(t, session.Created.Add(defaultSessionTTL), session.Expires, time.Second)
+	}
+
+	removed, err := svc.SweepSessions()
+	assert.NoError(t, err)
+	assert.Zero(t, removed, "sessions not expired are kept")
+
+	session.Expires = time.Now().Add(-time.Minute)
+	assert.NoError(t, svc.saveSession(session))
+
+	mi := &MappingInstruction{
+		Uuid:       options.Uuid,
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "externalArticleNumber"}, {ColIndex: 2, MappingValue: "currentStock"}},
+		UploadType: "stocks",
+	}
+	_, err = svc.WriteMapping(mi)
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeSessionExpired, importErr.Code)
+	}
+
+	// Uploads being imported are left alone
+	svc.activeSessions.acquire(options.Uuid)
+	removed, _ = svc.SweepSessions()
+	assert.Zero(t, removed)
+	svc.activeSessions.release(options.Uuid)
+
+	removed, err = svc.SweepSessions()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = store.Get(options.Uuid, csvFileName)
+	assert.ErrorIs(t, err, os.ErrNotExist, "files of expired sessions are removed")
+
+	_, err = svc.WriteMapping(mi)
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeSessionExpired, importErr.Code, "expired sessions are told apart from unknown uploads")
+	}
+
+	removed, _ = svc.SweepSessions()
+	assert.Zero(t, removed, "expired sessions are swept once")
+}
+
+func TestReadFileStoresOnlyValidUploads(t *testing.T) {
+	store := NewMemoryUploadStore()
+	svc := &mappingService{uploadStore: store}
+	uploadUuid := "6a1d3c52-9b4e-4f0a-8d7c-2e5f1b9a0c34"
+
+	for _, ud := range []*UploadData{
+		{UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")), UploadType: "unknown", Uuid: uploadUuid},
+		{UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")), UploadType: "stocks", Uuid: uploadUuid, Sheet: "Tabelle2"},
+	} {
+		_, err := svc.ReadFile(ud)
+		assert.Error(t, err)
+	}
+	uploads, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, uploads, "rejected uploads are not stored")
+
+	_, err = svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+		UploadType:   "stocks",
+		Uuid:         uploadUuid,
+	})
+	assert.NoError(t, err)
+
+	_, err = svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;99\n")),
+		UploadType:   "stocks",
+		Uuid:         uploadUuid,
+	})
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeUploadExists, importErr.Code)
+	}
+
+	data, err := store.Get(uploadUuid, csvFileName)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "31161;12", "existing uploads are not replaced")
+	}
+}
+
+func TestSweepSessionsAfterRestart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+
+	svc := &mappingService{uploadStore: NewLocalUploadStore(dir), sessionTTL: time.Millisecond}
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// A new instance on the same store knows nothing of the upload but its persisted session
+	restarted := &mappingService{uploadStore: NewLocalUploadStore(dir)}
+	removed, err := restarted.SweepSessions()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, filepath.Join(dir, options.Uuid, csvFileName))
+}
+
+func TestWriteMappingRacesSweeper(t *testing.T) {
+	svc := &mappingService{
+		uploadStore: NewMemoryUploadStore(),
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	for i := 0; i < 200; i++ {
+		options, err := svc.ReadFile(&UploadData{
+			UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+			UploadType:   "stocks",
+		})
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		// The session expires around the time the import starts
+		session, _ := svc.loadSession(options.Uuid)
+		session.Expires = time.Now().Add(time.Duration(i%20) * 10 * time.Microsecond)
+		assert.NoError(t, svc.saveSession(session))
+
+		done, swept := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(swept)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					svc.SweepSessions()
+				}
+			}
+		}()
+
+		_, err = svc.WriteMapping(&MappingInstruction{
+			Uuid:       options.Uuid,
+			Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "externalArticleNumber"}, {ColIndex: 2, MappingValue: "currentStock"}},
+			UploadType: "stocks",
+			DryRun:     true,
+		})
+		close(done)
+		<-swept
+
+		// Either the import keeps the sweeper away or it finds the session expired, it never runs on removed files
+		if err != nil {
+			var importErr *Error
+			if assert.ErrorAs(t, err, &importErr) {
+				assert.Equal(t, ErrCodeSessionExpired, importErr.Code)
+			}
+		}
+	}
+}
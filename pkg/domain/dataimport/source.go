@@ -0,0 +1,322 @@
+package dataimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// File names of the stored upload, depending on its format
+const (
+	xlsxFileName = "data.xlsx"
+	csvFileName  = "data.csv"
+)
+
+// Name of the only sheet of csv/tsv uploads
+const csvSheetName = "CSV"
+
+// Tabular data of an upload, independent of its file format (xlsx or csv/tsv)
+type tableSource interface {
+	GetSheetList() []string
+	Rows(sheet string) (rowIterator, error)
+	Close() error
+}
+
+type rowIterator interface {
+	Next() bool
+	Columns() ([]string, error)
+	// Returns the convention to parse the 1-based column of the row read by Columns with, given the NumberFormat
+	// of the upload. Number cells of xlsx uploads are formatted in English notation whatever the NumberFormat,
+	// e.g. "1,299.50", only text cells are written in the convention of the upload.
+	cellNumberFormat(col int, format NumberFormat) NumberFormat
+	Close() error
+}
+
+// Returns the value of the 1-based column of the row read by rowIterator.Columns, empty if the row ends before
+func cellAt(cols []string, col int) string {
+	if col < 1 || col > len(cols) {
+		return ""
+	}
+	return cols[col-1]
+}
+
+// Returns the name of the cell for error messages, e.g. "B3"
+func cellRef(col int, row int) string {
+	ref, _ := excelize.CoordinatesToCellName(col, row)
+	return ref
+}
+
+// Detects the format of the uploaded data and parses it. Returns the source and the file name to store the upload as.
+func parseUpload(data []byte) (tableSource, string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", err
+		}
+		return &xlsxSource{file}, xlsxFileName, nil
+	}
+
+	src, err := parseCSV(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return src, csvFileName, nil
+}
+
+// Opens the upload stored by ReadFile. The UploadStore hands out whole files, so the upload is held in memory
+// while it is imported, bounded by UploadLimits.MaxBytes.
+func openUpload(store UploadStore, uploadUuid string) (tableSource, error) {
+	data, err := store.Get(uploadUuid, xlsxFileName)
+	if err == nil {
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxSource{file}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err = store.Get(uploadUuid, csvFileName)
+	if err != nil {
+		return nil, err
+	}
+	return parseCSV(data)
+}
+
+type xlsxSource struct {
+	file *excelize.File
+}
+
+func (src *xlsxSource) GetSheetList() []string {
+	return src.file.GetSheetList()
+}
+
+func (src *xlsxSource) Rows(sheet string) (rowIterator, error) {
+	rows, err := src.file.Rows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := src.file.Rows(sheet)
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &xlsxRows{file: src.file, sheet: sheet, rows: rows, raw: raw}, nil
+}
+
+func (src *xlsxSource) Close() error {
+	return src.file.Close()
+}
+
+type xlsxRows struct {
+	file  *excelize.File
+	sheet string
+	rows  *excelize.Rows
+	// Same rows read with raw cell values, telling number cells from text cells
+	raw *excelize.Rows
+
+	row     int
+	cols    []string
+	rawCols []string
+}
+
+// Raw values of number cells, e.g. "1299.5" or "1.5E-05"
+var rawNumber = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d+)?$`)
+
+// Raw values of number cells a German NumberFormat would take for thousands, e.g. "0.125"
+var thousandsLikeNumber = regexp.MustCompile(`^-?\d+\.\d{3}$`)
+
+func (r *xlsxRows) Next() bool {
+	r.row++
+	r.cols, r.rawCols = nil, nil
+	r.raw.Next()
+	return r.rows.Next()
+}
+
+func (r *xlsxRows) Columns() ([]string, error) {
+	cols, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	rawCols, err := r.raw.Columns(excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	r.cols, r.rawCols = cols, rawCols
+	return cols, nil
+}
+
+func (r *xlsxRows) cellNumberFormat(col int, format NumberFormat) NumberFormat {
+	raw := cellAt(r.rawCols, col)
+	if format == NumberFormatEnglish || !rawNumber.MatchString(raw) {
+		return format
+	}
+	// Number formats only apply to number cells, e.g. "1,299.50" of 1299.5
+	if raw != cellAt(r.cols, col) {
+		return NumberFormatEnglish
+	}
+
+	// Numbers without number format look like text holding them. Their type only matters if they'd be taken for
+	// thousands, so it is only looked up then.
+	if format != NumberFormatGerman || !thousandsLikeNumber.MatchString(raw) {
+		return format
+	}
+	cellType, err := r.file.GetCellType(r.sheet, cellRef(col, r.row))
+	if err == nil && (cellType == excelize.CellTypeNumber || cellType == excelize.CellTypeUnset) {
+		return NumberFormatEnglish
+	}
+	return format
+}
+
+func (r *xlsxRows) Close() error {
+	r.raw.Close()
+	return r.rows.Close()
+}
+
+// csv/tsv upload, held in memory as a single sheet
+type csvSource struct {
+	records [][]string
+}
+
+var errBinaryData = errors.New("data is binary and neither xlsx nor csv")
+
+// Parses csv/tsv data. Delimiter (comma, semicolon, tab or pipe) and encoding (UTF-8 with or without BOM, Windows-1252) are detected.
+func parseCSV(data []byte) (*csvSource, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return nil, errBinaryData
+	}
+
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Trailing empty cells are dropped, the same way excelize does for xlsx rows
+	for i, record := range records {
+		records[i] = trimTrailingEmpty(record)
+	}
+
+	return &csvSource{records}, nil
+}
+
+// Picks the delimiter that splits the first lines most consistently into more than one column
+func detectDelimiter(data []byte) rune {
+	lines := make([]string, 0, 10)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == 10 {
+			break
+		}
+	}
+
+	best := ','
+	bestScore := 0
+	for _, delim := range []rune{',', ';', '\t', '|'} {
+		first := countDelimiter(lines[0], delim)
+		if first == 0 {
+			continue
+		}
+
+		consistent := 0
+		for _, line := range lines {
+			if countDelimiter(line, delim) == first {
+				consistent++
+			}
+		}
+
+		score := consistent*1000 + first
+		if score > bestScore {
+			best = delim
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// Counts delimiters outside of quoted fields
+func countDelimiter(line string, delim rune) int {
+	count := 0
+	quoted := false
+	for _, r := range line {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case delim:
+			if !quoted {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (src *csvSource) GetSheetList() []string {
+	return []string{csvSheetName}
+}
+
+func (src *csvSource) Rows(sheet string) (rowIterator, error) {
+	if sheet != csvSheetName {
+		return nil, excelize.ErrSheetNotExist{SheetName: sheet}
+	}
+	return &csvRows{records: src.records, index: -1}, nil
+}
+
+func (src *csvSource) Close() error {
+	return nil
+}
+
+type csvRows struct {
+	records [][]string
+	index   int
+}
+
+func (r *csvRows) Next() bool {
+	r.index++
+	return r.index < len(r.records)
+}
+
+func (r *csvRows) Columns() ([]string, error) {
+	if r.index < 0 || r.index >= len(r.records) {
+		return nil, nil
+	}
+	return r.records[r.index], nil
+}
+
+// csv/tsv has no number cells, all cells are written in the convention of the upload
+func (r *csvRows) cellNumberFormat(col int, format NumberFormat) NumberFormat {
+	return format
+}
+
+func (r *csvRows) Close() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package dataimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/hardware"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+	}{
+		{"comma", "a,b,c\n1,2,3\n", [][]string{{"a", "b", "c"}, {"1", "2", "3"}}},
+		{"semicolon with decimal comma", "Preis;Name\n\"29,99\";Allnet\n", [][]string{{"Preis", "Name"}, {"29,99", "Allnet"}}},
+		{"tab", "a\tb\n1\t2\n", [][]string{{"a", "b"}, {"1", "2"}}},
+		{"pipe", "a|b\n1|2\n", [][]string{{"a", "b"}, {"1", "2"}}},
+		{"utf-8 bom", "\xef\xbb\xbfEK;Bestand\n1;2\n", [][]string{{"EK", "Bestand"}, {"1", "2"}}},
+		{"windows-1252", "Gr\xfcndgeb\xfchr;\x80\n1;2\n", [][]string{{"Gründgebühr", "€"}, {"1", "2"}}},
+		{"crlf and trailing delimiters", "a;b;;\r\n1;;;\r\n", [][]string{{"a", "b"}, {"1"}}},
+		{"single column", "EbootisId\n100\n", [][]string{{"EbootisId"}, {"100"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseCSV([]byte(tt.data))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, src.records)
+			}
+		})
+	}
+}
+
+func TestParseCSVNegative(t *testing.T) {
+	_, err := parseCSV([]byte{})
+	assert.Error(t, err, "empty data should be rejected")
+
+	_, err = parseCSV([]byte("\x89PNG\r\n\x1a\n\x00\x00"))
+	assert.ErrorIs(t, err, errBinaryData)
+}
+
+func TestCSVSourceColumns(t *testing.T) {
+	src, err := parseCSV([]byte("a;b\n1;2\n3\n"))
+	if err != nil {
+		t.Fatalf("parsing csv failed: %v", err)
+	}
+
+	rows, err := src.Rows(csvSheetName)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer rows.Close()
+
+	var read [][]string
+	for rows.Next() {
+		cols, err := rows.Columns()
+		assert.NoError(t, err)
+		read = append(read, cols)
+	}
+	if assert.Len(t, read, 3) {
+		assert.Equal(t, "2", cellAt(read[1], 2))
+		assert.Equal(t, "", cellAt(read[2], 2), "cells beyond the row should be empty")
+	}
+
+	_, err = src.Rows("Tabelle1")
+	assert.Error(t, err)
+}
+
+func TestReadFileCSV(t *testing.T) {
+	svc := mappingService{}
+
+	result, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+		UploadType:   "stocks",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ArtNr", "Bestand"}, result.TableHeaders)
+	assert.Equal(t, [][]string{{"31161", "12"}}, result.TableSummary)
+	assert.FileExists(t, filepath.Join(os.TempDir(), result.Uuid, "data.csv"))
+}
+
+func TestWriteMappingCSV(t *testing.T) {
+	hw := &hardware.HardwareCRUD{
+		Id:       "hw1",
+		Variants: []*hardware.VariantCRUD{{EbootisId: "1000-1", ExternalArticleNumber: "31161"}},
+	}
+	svc := &mappingService{
+		hardwareAdapter: &crudMock[hardware.HardwareCRUD, hardware.HardwareLookup]{
+			list: func(o ...settings.Option) ([]*hardware.HardwareLookup, error) {
+				return []*hardware.HardwareLookup{{Id: "hw1"}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return hw, nil
+			},
+			update: func(s string, h *hardware.HardwareCRUD, o ...settings.Option) (*hardware.HardwareCRUD, error) {
+				return h, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr\tBestand\n31161\t12\n")),
+		UploadType:   "stocks",
+	})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "externalArticleNumber"},
+			{ColIndex: 2, MappingValue: "currentStock"},
+		},
+		UploadType: "stocks",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.SuccessfulRows)
+	assert.Equal(t, intPtr(12), hw.Variants[0].Stock)
+	_, err = os.Stat(filepath.Join(os.TempDir(), options.Uuid))
+	assert.True(t, os.IsNotExist(err), "upload should be removed after the import")
+}
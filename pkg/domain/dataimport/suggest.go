@@ -0,0 +1,227 @@
+package dataimport
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Minimum confidence for a column to be suggested at all
+const minSuggestionConfidence = 0.4
+
+// Suggests a field per column by fuzzy-matching the headers against keys, labels and aliases of the registry
+// and checking if the sample values fit the kind of the field. Every field and column is suggested at most once.
+func (r fieldRegistry[T]) suggest(headers []string, samples [][]string) []Suggestion {
+	type candidate struct {
+		col   int
+		field int
+		score float64
+	}
+
+	candidates := make([]candidate, 0)
+	for col, header := range headers {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+
+		profile := profileColumn(samples, col)
+		for i, f := range r {
+			score := f.headerScore(header)
+			score = f.adjustToSamples(score, profile)
+			if score >= minSuggestionConfidence {
+				candidates = append(candidates, candidate{col, i, score})
+			}
+		}
+	}
+
+	// Best matches first, ties are resolved by column and registry order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	usedCols := make(map[int]bool)
+	usedFields := make(map[int]bool)
+	result := make([]Suggestion, 0)
+	for _, c := range candidates {
+		if usedCols[c.col] || usedFields[c.field] {
+			continue
+		}
+		usedCols[c.col] = true
+		usedFields[c.field] = true
+
+		result = append(result, Suggestion{
+			MappingObject: MappingObject{ColIndex: c.col + 1, MappingValue: r[c.field].key},
+			Confidence:    math.Round(c.score*100) / 100,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ColIndex < result[j].ColIndex
+	})
+	return result
+}
+
+// Best similarity of the header to the key, the labels or any alias of the field
+func (f *fieldDef[T]) headerScore(header string) float64 {
+	names := append([]string{splitCamelCase(f.key), f.label}, f.aliases...)
+	for _, labels := range fieldLabels {
+		if label, ok := labels[f.key]; ok {
+			names = append(names, label)
+		}
+	}
+
+	best := 0.0
+	for _, name := range names {
+		best = math.Max(best, similarity(header, name))
+	}
+	return best
+}
+
+// Lowers the score if the samples don't fit the kind of the field and raises it slightly if they do
+func (f *fieldDef[T]) adjustToSamples(score float64, profile columnProfile) float64 {
+	if profile.values == 0 {
+		return score
+	}
+
+	switch {
+	case f.kind == floatValue || f.kind == intValue:
+		if profile.numeric < profile.values {
+			return score * 0.5
+		}
+		score += 0.1
+	case f.key == "pibLink" && profile.urls == profile.values:
+		score = math.Max(score, 0.6) + 0.1
+	case f.identifier && profile.unique:
+		score += 0.05
+	}
+
+	return math.Min(score, 1)
+}
+
+type columnProfile struct {
+	values  int // non-empty sample values
+	numeric int
+	urls    int
+	unique  bool
+}
+
+func profileColumn(samples [][]string, col int) columnProfile {
+	profile := columnProfile{unique: true}
+	seen := make(map[string]bool)
+
+	for _, row := range samples {
+		if col >= len(row) || strings.TrimSpace(row[col]) == "" {
+			continue
+		}
+		val := strings.TrimSpace(row[col])
+		profile.values++
+
+		if seen[val] {
+			profile.unique = false
+		}
+		seen[val] = true
+
+		if looksNumeric(val) {
+			profile.numeric++
+		}
+		if u, err := url.Parse(val); err == nil && u.Scheme != "" && u.Host != "" {
+			profile.urls++
+		}
+	}
+	return profile
+}
+
+// Reports whether s is a number in any of the units of the fields
+func looksNumeric(s string) bool {
+	for _, unit := range []numberUnit{unitNone, unitEuro, unitGigabyte, unitPercent} {
+		if _, err := parseNumber(s, NumberFormatAuto, unit); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Similarity of two names between 0 and 1, based on matching words and the edit distance of the whole names
+func similarity(a string, b string) float64 {
+	tokensA := tokenize(a)
+	tokensB := tokenize(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	compactA := strings.Join(tokensA, "")
+	compactB := strings.Join(tokensB, "")
+	if compactA == compactB {
+		return 1
+	}
+
+	// Dice coefficient over words, similar words (e.g. typos) count as match
+	matches := 0
+	used := make([]bool, len(tokensB))
+	for _, ta := range tokensA {
+		for j, tb := range tokensB {
+			if !used[j] && levenshteinRatio(ta, tb) >= 0.8 {
+				used[j] = true
+				matches++
+				break
+			}
+		}
+	}
+	dice := 2 * float64(matches) / float64(len(tokensA)+len(tokensB))
+
+	return math.Max(dice, levenshteinRatio(compactA, compactB)*0.9)
+}
+
+var umlautReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// Lowercase words of s with umlauts transcribed, e.g. "EK-Preis (Stück)" → [ek preis stueck]
+func tokenize(s string) []string {
+	s = umlautReplacer.Replace(strings.ToLower(s))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// "basicChargeRenewal" → "basic Charge Renewal"
+func splitCamelCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func levenshteinRatio(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,50 @@
+package dataimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestHardware(t *testing.T) {
+	headers := []string{"Ebootis ID", "Bezeichnung", "EK Preis", "Herstellr WKZ"}
+	samples := [][]string{
+		{"1000-1", "iPhone 15", "799,00", "10"},
+		{"1000-2", "iPhone 15 Pro", "999,00", "12"},
+	}
+
+	suggestions := hardwareFields.suggest(headers, samples)
+
+	assert.Equal(t, []Suggestion{
+		{MappingObject: MappingObject{ColIndex: 1, MappingValue: "ebootisId"}, Confidence: 1},
+		{MappingObject: MappingObject{ColIndex: 3, MappingValue: "price"}, Confidence: 1},
+		{MappingObject: MappingObject{ColIndex: 4, MappingValue: "manufactWkz"}, Confidence: 1},
+	}, suggestions)
+}
+
+func TestSuggestTariff(t *testing.T) {
+	headers := []string{"Bezeichnung", "EbootisId", "Grundgebühr", "PIB", "Datenvolumen"}
+	samples := [][]string{
+		{"Allnet S", "T-100", "19,99", "https://example.com/pib/1.pdf", "n/a"},
+	}
+
+	suggestions := tariffFields.suggest(headers, samples)
+	suggested := make(map[int]Suggestion)
+	for _, s := range suggestions {
+		suggested[s.ColIndex] = s
+	}
+
+	assert.NotContains(t, suggested, 1, "unrelated header should not be suggested")
+	assert.Equal(t, "ebootisId", suggested[2].MappingValue)
+	assert.Equal(t, "basicCharge", suggested[3].MappingValue)
+	assert.Equal(t, "pibLink", suggested[4].MappingValue)
+	assert.Less(t, suggested[5].Confidence, 0.9, "non-numeric samples should lower the confidence of numeric fields")
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, similarity("Ebootis ID", "ebootisId"))
+	assert.Equal(t, 1.0, similarity("Grundgebühr", "grundgebuehr"))
+	assert.Greater(t, similarity("Onlinepraemie", "Onlineprämie"), 0.9)
+	assert.Less(t, similarity("Bezeichnung", "Preis monatlich"), minSuggestionConfidence)
+	assert.Equal(t, 0.0, similarity("", "EK"))
+}
@@ -0,0 +1,246 @@
+package dataimport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage of mapping templates
+type TemplateStore interface {
+	// Returns all templates of the upload type
+	List(uploadType string) ([]*MappingTemplate, error)
+	// Creates the template or replaces the one with the same upload type and name
+	Save(*MappingTemplate) error
+	Delete(uploadType string, name string) error
+}
+
+// Identifies a table layout independent of whitespace and case of its headers
+func HeaderSignature(headers []string) string {
+	normalized := make([]string, len(headers))
+	for i, h := range headers {
+		normalized[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(normalized, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// TemplateStore keeping all templates in a single JSON file
+type jsonTemplateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJSONTemplateStore(path string) TemplateStore {
+	return &jsonTemplateStore{path: path}
+}
+
+func (store *jsonTemplateStore) List(uploadType string) ([]*MappingTemplate, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	templates, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*MappingTemplate, 0)
+	for _, t := range templates {
+		if t.UploadType == uploadType {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+func (store *jsonTemplateStore) Save(template *MappingTemplate) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	templates, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, t := range templates {
+		if t.UploadType == template.UploadType && t.Name == template.Name {
+			templates[i] = template
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		templates = append(templates, template)
+	}
+
+	return store.write(templates)
+}
+
+func (store *jsonTemplateStore) Delete(uploadType string, name string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	templates, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	result := make([]*MappingTemplate, 0, len(templates))
+	for _, t := range templates {
+		if t.UploadType != uploadType || t.Name != name {
+			result = append(result, t)
+		}
+	}
+
+	return store.write(result)
+}
+
+func (store *jsonTemplateStore) load() ([]*MappingTemplate, error) {
+	templates := make([]*MappingTemplate, 0)
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return templates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (store *jsonTemplateStore) write(templates []*MappingTemplate) error {
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(store.path), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path, data)
+}
+
+// Writes into a temporary file next to path first, so a crash can't leave a truncated file behind. Temporary files
+// are unique, so writers sharing the directory don't clobber each other's.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Fails once the file is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp restricts the file to its owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (svc *mappingService) ListTemplates(uploadType string) ([]*MappingTemplate, error) {
+	if svc.templateStore == nil {
+		return nil, errTemplatesUnavailable()
+	}
+
+	templates, err := svc.templateStore.List(uploadType)
+	if err != nil {
+		log.Error(err)
+		return nil, newError(Error{Code: ErrCodeTemplateStoreFailed})
+	}
+	return templates, nil
+}
+
+func (svc *mappingService) SaveTemplate(template *MappingTemplate) error {
+	if svc.templateStore == nil {
+		return errTemplatesUnavailable()
+	}
+
+	if strings.TrimSpace(template.Name) == "" {
+		return newError(Error{Code: ErrCodeTemplateInvalid})
+	}
+
+	if err := validateMapping(template.UploadType, template.Mapping); err != nil {
+		return err
+	}
+
+	if !template.NumberFormat.valid() {
+		return errNumberFormatUnknown(template.NumberFormat)
+	}
+
+	if template.HeaderSignature == "" {
+		if len(template.Headers) == 0 {
+			return newError(Error{Code: ErrCodeTemplateInvalid})
+		}
+		template.HeaderSignature = HeaderSignature(template.Headers)
+	}
+
+	if err := svc.templateStore.Save(template); err != nil {
+		log.Error(err)
+		return newError(Error{Code: ErrCodeTemplateStoreFailed})
+	}
+	return nil
+}
+
+func (svc *mappingService) DeleteTemplate(uploadType string, name string) error {
+	if svc.templateStore == nil {
+		return errTemplatesUnavailable()
+	}
+
+	if err := svc.templateStore.Delete(uploadType, name); err != nil {
+		log.Error(err)
+		return newError(Error{Code: ErrCodeTemplateStoreFailed})
+	}
+	return nil
+}
+
+// Returns the templates of the upload type matching the table headers.
+// Templates are optional for reading files, so failures are only logged.
+func (svc *mappingService) matchingTemplates(uploadType string, headers []string) []*MappingTemplate {
+	result := make([]*MappingTemplate, 0)
+	if svc.templateStore == nil {
+		return result
+	}
+
+	templates, err := svc.templateStore.List(uploadType)
+	if err != nil {
+		log.Error(err)
+		return result
+	}
+
+	signature := HeaderSignature(headers)
+	for _, t := range templates {
+		if t.HeaderSignature == signature {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func errTemplatesUnavailable() *Error {
+	return newError(Error{Code: ErrCodeTemplatesDisabled})
+}
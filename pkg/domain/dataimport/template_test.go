@@ -0,0 +1,111 @@
+package dataimport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderSignature(t *testing.T) {
+	assert.Equal(t, HeaderSignature([]string{"ArtNr", "WKZ"}), HeaderSignature([]string{" artnr", "WKZ "}))
+	assert.NotEqual(t, HeaderSignature([]string{"ArtNr", "WKZ"}), HeaderSignature([]string{"WKZ", "ArtNr"}))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "templates.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, writeFileAtomic(path, []byte(fmt.Sprintf("writer %d", i))))
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^writer [0-9]+$", string(data), "concurrent writers leave one complete file")
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	}
+}
+
+func TestJSONTemplateStore(t *testing.T) {
+	store := NewJSONTemplateStore(filepath.Join(t.TempDir(), "templates.json"))
+
+	templates, err := store.List("hardware")
+	assert.NoError(t, err, "missing file should be treated as empty store")
+	assert.Empty(t, templates)
+
+	assert.NoError(t, store.Save(&MappingTemplate{Name: "Lieferant A", UploadType: "hardware"}))
+	assert.NoError(t, store.Save(&MappingTemplate{Name: "Lieferant A", UploadType: "tariff"}))
+	assert.NoError(t, store.Save(&MappingTemplate{Name: "Lieferant A", UploadType: "hardware", HeaderSignature: "abc"}))
+
+	templates, err = store.List("hardware")
+	assert.NoError(t, err)
+	assert.Len(t, templates, 1, "saving with the same name should replace the template")
+	assert.Equal(t, "abc", templates[0].HeaderSignature)
+
+	assert.NoError(t, store.Delete("hardware", "Lieferant A"))
+	templates, _ = store.List("hardware")
+	assert.Empty(t, templates)
+	templates, _ = store.List("tariff")
+	assert.Len(t, templates, 1)
+}
+
+func TestReadFileMatchingTemplates(t *testing.T) {
+	file, err := os.ReadFile("../../../test/positive.xlsx")
+	if err != nil {
+		t.Fatalf("Loading test .xlsx failed: %v", err)
+	}
+
+	svc := &mappingService{
+		templateStore: NewJSONTemplateStore(filepath.Join(t.TempDir(), "templates.json")),
+	}
+
+	mapping := []MappingObject{{ColIndex: 1, MappingValue: "externalArticleNumber"}, {ColIndex: 3, MappingValue: "manufactWkz"}}
+	assert.NoError(t, svc.SaveTemplate(&MappingTemplate{
+		Name:       "Wochenliste",
+		UploadType: "hardware",
+		Headers:    []string{"ArtNr", "Artikel-Bezeichnung", "WKZ", "gültig bis"},
+		Mapping:    mapping,
+	}))
+	assert.NoError(t, svc.SaveTemplate(&MappingTemplate{
+		Name:       "Andere Liste",
+		UploadType: "hardware",
+		Headers:    []string{"EbootisId", "EK"},
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "ebootisId"}},
+	}))
+
+	err = svc.SaveTemplate(&MappingTemplate{
+		Name:       "Ungültig",
+		UploadType: "hardware",
+		Headers:    []string{"ArtNr"},
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "pibLink"}},
+	})
+	assert.Error(t, err, "templates with unknown mapping values should be rejected")
+
+	result, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader(file),
+		UploadType:   "hardware",
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Templates, 1) {
+		assert.Equal(t, "Wochenliste", result.Templates[0].Name)
+		assert.Equal(t, mapping, result.Templates[0].Mapping)
+	}
+}
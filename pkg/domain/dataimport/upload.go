@@ -0,0 +1,239 @@
+package dataimport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Name of the file holding the expiry of an upload in its directory, see localUploadStore
+const expiryFileName = ".expires"
+
+var errUploadKeyInvalid = errors.New("invalid upload uuid or file name")
+
+// Storage of uploaded files and the files generated from them, e.g. the error report, grouped by upload uuid
+type UploadStore interface {
+	// Stores the file of the upload. The upload is removed along with all its files once ttl elapsed, 0 keeps it
+	// until it is deleted. Every Put sets the expiry of the whole upload.
+	Put(uuid string, name string, data []byte, ttl time.Duration) error
+	// Returns the file of the upload, os.ErrNotExist if there is none or the upload expired
+	Get(uuid string, name string) ([]byte, error)
+	// Removes the upload along with all its files
+	Delete(uuid string) error
+	// Returns the uuids of all uploads not expired. Expired uploads are removed.
+	List() ([]string, error)
+}
+
+// Accepts uuids in their canonical form only, e.g. 3fc7522d-ed25-40df-9972-333ba8aea504. Other forms accepted by
+// uuid.Parse (braces, urn prefix, upper case) would store the same upload under different names.
+func validUuid(s string) bool {
+	parsed, err := uuid.Parse(s)
+	return err == nil && parsed.String() == s
+}
+
+// Accepts plain file names, which can't leave the directory of the upload or collide with its expiry file
+func validFileName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
+
+// UploadStore keeping every upload in its own directory named after the uuid
+type localUploadStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewLocalUploadStore(dir string) UploadStore {
+	return &localUploadStore{dir: dir}
+}
+
+func (store *localUploadStore) Put(uploadUuid string, name string, data []byte, ttl time.Duration) error {
+	if !validUuid(uploadUuid) || !validFileName(name) {
+		return errUploadKeyInvalid
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Files of an expired upload mustn't be revived along with the new one
+	dirPath := filepath.Join(store.dir, uploadUuid)
+	if store.expired(dirPath) {
+		if err := os.RemoveAll(dirPath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(dirPath, name), data); err != nil {
+		return err
+	}
+
+	expiryPath := filepath.Join(dirPath, expiryFileName)
+	if ttl <= 0 {
+		if err := os.Remove(expiryPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(expiryPath, []byte(time.Now().Add(ttl).Format(time.RFC3339Nano)))
+}
+
+func (store *localUploadStore) Get(uploadUuid string, name string) ([]byte, error) {
+	if !validUuid(uploadUuid) || !validFileName(name) {
+		return nil, os.ErrNotExist
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	dirPath := filepath.Join(store.dir, uploadUuid)
+	if store.expired(dirPath) {
+		os.RemoveAll(dirPath)
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(dirPath, name))
+}
+
+func (store *localUploadStore) Delete(uploadUuid string) error {
+	if !validUuid(uploadUuid) {
+		return errUploadKeyInvalid
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return os.RemoveAll(filepath.Join(store.dir, uploadUuid))
+}
+
+func (store *localUploadStore) List() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory may be shared, e.g. the temp directory of the host, so only uuid directories are uploads
+	uploads := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !validUuid(entry.Name()) {
+			continue
+		}
+
+		dirPath := filepath.Join(store.dir, entry.Name())
+		if store.expired(dirPath) {
+			os.RemoveAll(dirPath)
+			continue
+		}
+		uploads = append(uploads, entry.Name())
+	}
+	return uploads, nil
+}
+
+// Uploads without a readable expiry are kept, they are removed by Delete only
+func (store *localUploadStore) expired(dirPath string) bool {
+	data, err := os.ReadFile(filepath.Join(dirPath, expiryFileName))
+	if err != nil {
+		return false
+	}
+	expiry, err := time.Parse(time.RFC3339Nano, string(data))
+	return err == nil && time.Now().After(expiry)
+}
+
+type memoryUpload struct {
+	files   map[string][]byte
+	expires time.Time // zero if kept until deleted
+}
+
+func (upload *memoryUpload) expired() bool {
+	return !upload.expires.IsZero() && time.Now().After(upload.expires)
+}
+
+// UploadStore keeping all uploads in memory, e.g. for tests or a single instance without writable disk
+type memoryUploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]*memoryUpload
+}
+
+func NewMemoryUploadStore() UploadStore {
+	return &memoryUploadStore{uploads: make(map[string]*memoryUpload)}
+}
+
+func (store *memoryUploadStore) Put(uploadUuid string, name string, data []byte, ttl time.Duration) error {
+	if !validUuid(uploadUuid) || !validFileName(name) {
+		return errUploadKeyInvalid
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	upload, ok := store.uploads[uploadUuid]
+	if !ok || upload.expired() {
+		upload = &memoryUpload{files: make(map[string][]byte)}
+		store.uploads[uploadUuid] = upload
+	}
+
+	upload.files[name] = append([]byte(nil), data...)
+	upload.expires = time.Time{}
+	if ttl > 0 {
+		upload.expires = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (store *memoryUploadStore) Get(uploadUuid string, name string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	upload, ok := store.uploads[uploadUuid]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if upload.expired() {
+		delete(store.uploads, uploadUuid)
+		return nil, os.ErrNotExist
+	}
+
+	data, ok := upload.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (store *memoryUploadStore) Delete(uploadUuid string) error {
+	if !validUuid(uploadUuid) {
+		return errUploadKeyInvalid
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.uploads, uploadUuid)
+	return nil
+}
+
+func (store *memoryUploadStore) List() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	uploads := make([]string, 0, len(store.uploads))
+	for uploadUuid, upload := range store.uploads {
+		if upload.expired() {
+			delete(store.uploads, uploadUuid)
+			continue
+		}
+		uploads = append(uploads, uploadUuid)
+	}
+	sort.Strings(uploads)
+	return uploads, nil
+}
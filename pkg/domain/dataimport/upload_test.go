@@ -0,0 +1,162 @@
+package dataimport
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Filipza/excel-mapping-tool/internal/domain/v1/tariff"
+	"github.com/Filipza/excel-mapping-tool/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) UploadStore{
+		"local": func(t *testing.T) UploadStore {
+			return NewLocalUploadStore(filepath.Join(t.TempDir(), "uploads"))
+		},
+		"memory": func(t *testing.T) UploadStore {
+			return NewMemoryUploadStore()
+		},
+	}
+
+	const uploadUuid = "3fc7522d-ed25-40df-9972-333ba8aea504"
+	const expiringUuid = "0f8c6a52-8d0e-4c43-9a3e-2b7c5d1e4f60"
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			_, err := store.Get(uploadUuid, xlsxFileName)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			uploads, err := store.List()
+			assert.NoError(t, err)
+			assert.Empty(t, uploads)
+
+			assert.NoError(t, store.Put(uploadUuid, xlsxFileName, []byte("data"), 0))
+			assert.NoError(t, store.Put(uploadUuid, reportFileName, []byte("report"), time.Hour))
+
+			data, err := store.Get(uploadUuid, xlsxFileName)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "data", string(data))
+			}
+			_, err = store.Get(uploadUuid, csvFileName)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			for _, invalid := range []string{
+				"",
+				"../../etc",
+				"longdirname" + strings.Repeat("a", 300),
+				"3FC7522D-ED25-40DF-9972-333BA8AEA504",
+				"{3fc7522d-ed25-40df-9972-333ba8aea504}",
+				"urn:uuid:3fc7522d-ed25-40df-9972-333ba8aea504",
+				"3fc7522ded2540df9972333ba8aea504",
+			} {
+				assert.Error(t, store.Put(invalid, xlsxFileName, []byte("data"), 0), "uuid %q", invalid)
+				_, err := store.Get(invalid, xlsxFileName)
+				assert.ErrorIs(t, err, os.ErrNotExist, "uuid %q", invalid)
+				assert.Error(t, store.Delete(invalid), "uuid %q", invalid)
+			}
+			for _, invalid := range []string{"", "../data.xlsx", "sub/data.xlsx", expiryFileName} {
+				assert.Error(t, store.Put(uploadUuid, invalid, []byte("data"), 0), "name %q", invalid)
+			}
+
+			assert.NoError(t, store.Put(expiringUuid, xlsxFileName, []byte("data"), time.Millisecond))
+			time.Sleep(10 * time.Millisecond)
+
+			_, err = store.Get(expiringUuid, xlsxFileName)
+			assert.ErrorIs(t, err, os.ErrNotExist, "expired uploads are gone")
+
+			uploads, err = store.List()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{uploadUuid}, uploads)
+
+			assert.NoError(t, store.Delete(uploadUuid))
+			_, err = store.Get(uploadUuid, reportFileName)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func TestWriteMappingUploadStore(t *testing.T) {
+	upload := newTestWorkbook(t, [][]string{
+		{"EbootisId", "Grundgebühr"},
+		{"T-1", "9,99"},
+		{"T-2", "abc"},
+	})
+
+	store := NewMemoryUploadStore()
+	svc := &mappingService{
+		uploadStore: store,
+		tariffAdapter: &crudMock[tariff.TariffCRUD, tariff.TariffLookup]{
+			list: func(o ...settings.Option) ([]*tariff.TariffLookup, error) {
+				return []*tariff.TariffLookup{{Id: o[0].Value.(string)}}, nil
+			},
+			read: func(s string, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return &tariff.TariffCRUD{Id: s}, nil
+			},
+			update: func(s string, tc *tariff.TariffCRUD, o ...settings.Option) (*tariff.TariffCRUD, error) {
+				return tc, nil
+			},
+		},
+	}
+
+	options, err := svc.ReadFile(&UploadData{UploadedFile: bytes.NewReader(upload), UploadType: "tariff"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	assert.NoDirExists(t, filepath.Join(os.TempDir(), options.Uuid), "uploads are kept in the configured store only")
+
+	_, err = store.Get(options.Uuid, xlsxFileName)
+	assert.NoError(t, err)
+
+	result, err := svc.WriteMapping(&MappingInstruction{
+		Uuid: options.Uuid,
+		Mapping: []MappingObject{
+			{ColIndex: 1, MappingValue: "ebootisId"},
+			{ColIndex: 2, MappingValue: "basicCharge"},
+		},
+		UploadType:     "tariff",
+		AnnotateErrors: true,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, result.SuccessfulRows)
+		assert.True(t, result.ErrorReport)
+	}
+
+	report, err := svc.ErrorReport(options.Uuid)
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(report)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, data)
+		report.Close()
+	}
+}
+
+func TestReadFileUuidInvalid(t *testing.T) {
+	svc := &mappingService{uploadStore: NewMemoryUploadStore()}
+
+	_, err := svc.ReadFile(&UploadData{
+		UploadedFile: bytes.NewReader([]byte("ArtNr;Bestand\n31161;12\n")),
+		UploadType:   "stocks",
+		Uuid:         "../../etc",
+	})
+	var importErr *Error
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeUuidInvalid, importErr.Code)
+	}
+
+	_, err = svc.WriteMapping(&MappingInstruction{
+		Uuid:       "../../etc",
+		Mapping:    []MappingObject{{ColIndex: 1, MappingValue: "externalArticleNumber"}},
+		UploadType: "stocks",
+	})
+	if assert.ErrorAs(t, err, &importErr) {
+		assert.Equal(t, ErrCodeUploadNotFound, importErr.Code)
+	}
+}